@@ -1,30 +1,48 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/adaptive"
 	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/analytics"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/cache"
 	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/chaos"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/circuit"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/concurrency"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/config"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/gateway"
 	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/middleware"
 	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/observability"
-	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/proxy"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/quota"
 	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/ratelimit"
 	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/tenant"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/upstream"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func basicAuth(handler http.Handler, username, password string) http.Handler {
+func basicAuth(handler http.Handler, realm, username, password string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user, pass, ok := r.BasicAuth()
 
-		if !ok || user != username || pass != password {
-			w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+		if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(pass), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`"`)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
@@ -34,6 +52,10 @@ func basicAuth(handler http.Handler, username, password string) http.Handler {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "validate-config" {
+		os.Exit(validateConfig(os.Args[2:]))
+	}
+
 	// ---- Start mock services as goroutines (separate muxes) ----
 	go startUserService()
 	go startOrderService()
@@ -47,7 +69,7 @@ func main() {
 	gatewayMux := http.NewServeMux()
 	metricsUsername := getEnv("METRICS_USERNAME", "grafana")
 	metricsPassword := getEnv("METRICS_PASSWORD", "metrics_secure_2026")
-	gatewayMux.Handle("/metrics", basicAuth(promhttp.Handler(), metricsUsername, metricsPassword))
+	gatewayMux.Handle("/metrics", basicAuth(promhttp.Handler(), "metrics", metricsUsername, metricsPassword))
 	// ---- Chaos auto-recovery watcher ----
 	chaos.AutoRecover()
 
@@ -64,50 +86,222 @@ func main() {
 		rdb = redis.NewClient(&redis.Options{Addr: redisAddr})
 	}
 
+	// ---- Tenant Store ----
+	// memory (default): built-in demo tenants
+	// file:  TENANT_FILE (YAML or JSON), reloaded when the file changes
+	// redis: shared hash, reloaded on pub/sub notification
+	switch storeType := getEnv("TENANT_STORE", "memory"); storeType {
+	case "memory":
+	case "file":
+		fileStore, err := tenant.NewFileStore(getEnv("TENANT_FILE", "tenants.yaml"))
+		if err != nil {
+			log.Fatalf("failed to load tenant file: %v", err)
+		}
+		fileStore.Watch(5 * time.Second)
+		tenant.SetStore(fileStore)
+	case "redis":
+		redisStore, err := tenant.NewRedisStore(rdb)
+		if err != nil {
+			log.Fatalf("failed to load tenants from redis: %v", err)
+		}
+		redisStore.Watch(30 * time.Second)
+		tenant.SetStore(redisStore)
+	default:
+		log.Fatalf("unknown TENANT_STORE %q (want memory, file or redis)", storeType)
+	}
+
+	// ---- Bearer Token (JWT) Authentication ----
+	// Enabled when JWT_JWKS_FILE or JWT_JWKS_URL is set; X-API-Key still works
+	var keySet *tenant.KeySet
+	if jwksFile := os.Getenv("JWT_JWKS_FILE"); jwksFile != "" {
+		ks, err := tenant.NewFileKeySet(jwksFile)
+		if err != nil {
+			log.Fatalf("failed to load JWKS file: %v", err)
+		}
+		keySet = ks
+	} else if jwksURL := os.Getenv("JWT_JWKS_URL"); jwksURL != "" {
+		ks, err := tenant.NewURLKeySet(jwksURL, 5*time.Minute)
+		if err != nil {
+			log.Fatalf("failed to fetch JWKS: %v", err)
+		}
+		keySet = ks
+	}
+	if keySet != nil {
+		tenant.SetJWTValidator(tenant.NewJWTValidator(tenant.JWTConfig{
+			Keys:        keySet,
+			Issuer:      os.Getenv("JWT_ISSUER"),
+			Audience:    os.Getenv("JWT_AUDIENCE"),
+			TenantClaim: getEnv("JWT_TENANT_CLAIM", "tenant_id"),
+			Leeway:      30 * time.Second,
+			AllowNoExp:  os.Getenv("JWT_ALLOW_NO_EXP") == "true",
+		}))
+	}
+
 	// ---- Analytics Engine ----
 	analyticsEngine := analytics.NewAnalytics(rdb)
 
 	// ---- Rate Limiter ----
+	// 5/minute applies to tenants without a plan; tiers come from ratelimit.DefaultPlans
 	rl := ratelimit.NewRateLimiter(rdb, 5, time.Minute)
+	replicas := getEnvInt("RATELIMIT_REPLICAS", 1)
+	if err := rl.SetFailurePolicy(getEnv("RATELIMIT_FAILURE_POLICY", ratelimit.FailLocal), replicas); err != nil {
+		log.Fatalf("invalid rate limit failure policy: %v", err)
+	}
+	// Tier limits changed through /admin/plans are kept in Redis
+	if err := rl.LoadPlans(context.Background()); err != nil {
+		log.Printf("[RATELIMIT] using default plans: %v", err)
+	}
+	rl.WatchPlans(30 * time.Second)
+	rulesFile := os.Getenv("RATELIMIT_RULES_FILE")
+	// readRules checks the rules file without applying it, so a reload can
+	// reject it before anything changes
+	readRules := func() ([]ratelimit.Rule, error) {
+		rules, err := ratelimit.LoadRules(rulesFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := ratelimit.ValidateRules(rules); err != nil {
+			return nil, fmt.Errorf("invalid rate limit rules in %s: %w", rulesFile, err)
+		}
+		return rules, nil
+	}
+	applyRules := func(rules []ratelimit.Rule) {
+		rl.SetRules(rules)
+		log.Printf("Loaded %d rate limit rules from %s", len(rules), rulesFile)
+	}
+	if rulesFile != "" {
+		rules, err := readRules()
+		if err != nil {
+			log.Fatalf("failed to load rate limit rules: %v", err)
+		}
+		applyRules(rules)
+	}
 
-	// ---- Backend proxies ----
-	userServiceURL := getEnv("USER_SERVICE_URL", "http://localhost:9001")
-	orderServiceURL := getEnv("ORDER_SERVICE_URL", "http://localhost:9002")
-	userHandler, _ := proxy.ProxyHandler(userServiceURL)
-	orderHandler, _ := proxy.ProxyHandler(orderServiceURL)
-
-	// ---- Middleware Stack for Secured Endpoints ----
-	// Order (from outer to inner):
-	// 1. Tenant Resolution  - Extracts tenant from X-API-Key (non-blocking)
-	// 2. Analytics          - Records all requests, latency, errors (even if blocked later)
-	// 3. Chaos              - Simulates latency/errors if enabled (tracks ALL requests)
-	// 4. Rate Limiter       - Enforces rate limits per tenant
-	// 5. Backend Handler    - Forwards to upstream service
-
-	securedUserHandler := tenant.ResolutionMiddleware(
-		analytics.Middleware(
-			analyticsEngine,
-			chaos.Middleware(
-				rl.Middleware(userHandler),
-			),
-		),
-	)
+	// ---- Billing Quotas ----
+	quotas := quota.NewEnforcer(rdb)
+	if v := os.Getenv("QUOTA_WARN_THRESHOLDS"); v != "" {
+		var thresholds []int
+		for _, part := range strings.Split(v, ",") {
+			p, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				log.Fatalf("invalid QUOTA_WARN_THRESHOLDS: %v", err)
+			}
+			thresholds = append(thresholds, p)
+		}
+		if err := quotas.SetThresholds(thresholds); err != nil {
+			log.Fatalf("invalid QUOTA_WARN_THRESHOLDS: %v", err)
+		}
+	}
 
-	securedOrderHandler := tenant.ResolutionMiddleware(
-		analytics.Middleware(
-			analyticsEngine,
-			chaos.Middleware(
-				rl.Middleware(orderHandler),
-			),
-		),
-	)
+	// ---- Concurrency Limiter ----
+	concurrencyCfg := concurrency.Config{
+		TenantLimit:  getEnvInt("CONCURRENCY_TENANT_LIMIT", 50),
+		BackendLimit: getEnvInt("CONCURRENCY_BACKEND_LIMIT", 200),
+		QueueSize:    getEnvInt("CONCURRENCY_QUEUE_SIZE", 0),
+		QueueTimeout: getEnvDuration("CONCURRENCY_QUEUE_TIMEOUT", 2*time.Second),
+		Lease:        getEnvDuration("CONCURRENCY_LEASE", 30*time.Second),
+	}
+	var inFlight *concurrency.Limiter
+	switch mode := getEnv("CONCURRENCY_MODE", "local"); mode {
+	case "local":
+		inFlight = concurrency.NewLocal(concurrencyCfg)
+	case "redis":
+		inFlight = concurrency.NewDistributed(rdb, concurrencyCfg)
+	default:
+		log.Fatalf("unknown CONCURRENCY_MODE %q (want local or redis)", mode)
+	}
+
+	// ---- Adaptive Load Shedding ----
+	adaptiveCfg := adaptive.DefaultConfig
+	adaptiveCfg.MinLimit = getEnvInt("ADAPTIVE_LIMIT_MIN", adaptiveCfg.MinLimit)
+	adaptiveCfg.MaxLimit = getEnvInt("ADAPTIVE_LIMIT_MAX", adaptiveCfg.MaxLimit)
+	shedder := adaptive.NewLimiter(adaptiveCfg)
+	middleware.AddObserver(shedder.Observe)
+
+	// ---- Circuit Breakers ----
+	circuitCfg := circuit.DefaultConfig
+	circuitCfg.FailureRatio = getEnvFloat("CIRCUIT_FAILURE_RATIO", circuitCfg.FailureRatio)
+	circuitCfg.MinRequests = getEnvInt("CIRCUIT_MIN_REQUESTS", circuitCfg.MinRequests)
+	circuitCfg.Window = getEnvDuration("CIRCUIT_WINDOW", circuitCfg.Window)
+	circuitCfg.OpenTimeout = getEnvDuration("CIRCUIT_OPEN_TIMEOUT", circuitCfg.OpenTimeout)
+	circuitCfg.HalfOpenProbes = getEnvInt("CIRCUIT_HALF_OPEN_PROBES", circuitCfg.HalfOpenProbes)
+	if circuitCfg.FailureRatio <= 0 || circuitCfg.FailureRatio > 1 {
+		log.Fatalf("CIRCUIT_FAILURE_RATIO must be in (0, 1]")
+	}
+	breakers := circuit.New(circuitCfg)
+
+	// ---- Response Cache ----
+	// Routes opt in with a cache block; entries are always keyed by tenant
+	var responses *cache.Cache
+	switch backend := getEnv("CACHE_BACKEND", "memory"); backend {
+	case "memory":
+		responses = cache.NewLocal(getEnvInt("CACHE_MAX_ENTRIES", 10000), getEnvInt("CACHE_MAX_BYTES", 256<<20))
+	case "redis":
+		responses = cache.NewRedis(rdb)
+	default:
+		log.Fatalf("unknown CACHE_BACKEND %q (want memory or redis)", backend)
+	}
 
-	// ---- Router ----
-	router := proxy.NewRouter()
-	router.AddRoute("/users", securedUserHandler)
-	router.AddRoute("/orders", securedOrderHandler)
+	// ---- Routing table ----
+	// GATEWAY_CONFIG names a YAML/JSON file (see gateway.example.yaml); without
+	// it the built-in routes proxy to USER_SERVICE_URL and ORDER_SERVICE_URL.
+	cfg := defaultConfig()
+	configFile := os.Getenv("GATEWAY_CONFIG")
+	if configFile != "" {
+		loaded, err := config.Load(configFile)
+		if err != nil {
+			log.Fatalf("invalid gateway config %s:\n%v", configFile, err)
+		}
+		cfg = loaded
+		log.Printf("Loaded %d routes from %s", len(cfg.Routes), configFile)
+	}
 
-	router.AddRoute("/admin/analytics", analytics.Handler(analyticsEngine))
+	// Connection timeouts for upstreams that don't set their own
+	upstreamTimeouts := upstream.Timeouts{
+		Dial:           getEnvDuration("UPSTREAM_DIAL_TIMEOUT", upstream.DefaultTimeouts.Dial),
+		TLSHandshake:   getEnvDuration("UPSTREAM_TLS_HANDSHAKE_TIMEOUT", upstream.DefaultTimeouts.TLSHandshake),
+		ResponseHeader: getEnvDuration("UPSTREAM_RESPONSE_HEADER_TIMEOUT", upstream.DefaultTimeouts.ResponseHeader),
+	}
+	upstreams := upstream.NewRegistry(upstreamTimeouts)
+
+	// The live router is rebuilt and swapped on file change, SIGHUP or
+	// POST /admin/config/reload; rate limit rules are reloaded with it.
+	router, err := gateway.NewLive(configFile, cfg, gateway.Deps{
+		Analytics:   analyticsEngine,
+		RateLimiter: rl,
+		Concurrency: inFlight,
+		Quotas:      quotas,
+		Shedder:     shedder,
+		Upstreams:   upstreams,
+		Breakers:    breakers,
+		Cache:       responses,
+		Handlers: map[string]http.Handler{
+			"analytics": analytics.Handler(analyticsEngine),
+		},
+	})
+	if err != nil {
+		log.Fatalf("failed to build routes: %v", err)
+	}
+	if rulesFile != "" {
+		router.OnReload(func(*config.Config) (func(), error) {
+			rules, err := readRules()
+			if err != nil {
+				return nil, err
+			}
+			return func() { applyRules(rules) }, nil
+		})
+	}
+	router.Watch(5 * time.Second)
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			if _, err := router.Reload(); err != nil {
+				log.Printf("[CONFIG] SIGHUP reload failed, keeping current routes: %v", err)
+			}
+		}
+	}()
 
 	finalHandler := middleware.Logging(
 		tenant.ResolutionMiddleware(
@@ -119,11 +313,57 @@ func main() {
 
 	gatewayMux.Handle("/", finalHandler)
 
+	// ---- ADMIN API ----
+	// Admin endpoints need the admin credentials. The chaos, metrics and
+	// analytics endpoints the demo page and Grafana call stay open.
+	adminUsername := getEnv("ADMIN_USERNAME", "admin")
+	adminPassword := os.Getenv("ADMIN_PASSWORD")
+	if adminPassword == "" {
+		adminPassword = randomPassword()
+		log.Printf("ADMIN_PASSWORD not set; admin API password for this run: %s", adminPassword)
+	}
+	admin := func(h http.HandlerFunc) http.Handler {
+		return basicAuth(h, "admin", adminUsername, adminPassword)
+	}
+
 	// ---- CHAOS ADMIN API ----
 	gatewayMux.HandleFunc("/admin/chaos", chaos.ChaosConfigHandler)
 	gatewayMux.HandleFunc("/admin/chaos/recover", chaos.ChaosRecoverHandler)
 	gatewayMux.HandleFunc("/admin/chaos/status", chaos.ChaosStatusHandler)
 
+	// ---- TENANT ADMIN API ----
+	gatewayMux.Handle("/admin/tenants", admin(tenant.TenantsHandler))
+	gatewayMux.Handle("/admin/tenants/{id}", admin(tenant.TenantHandler))
+	gatewayMux.Handle("/admin/tenants/{id}/suspend", admin(tenant.SuspendHandler))
+	gatewayMux.Handle("/admin/tenants/{id}/resume", admin(tenant.ResumeHandler))
+	gatewayMux.Handle("/admin/tenants/{id}/keys", admin(tenant.KeysHandler))
+	gatewayMux.Handle("/admin/tenants/{id}/keys/{keyID}", admin(tenant.RevokeKeyHandler))
+	gatewayMux.Handle("/admin/tenants/{id}/keys/{keyID}/rotate", admin(tenant.RotateKeyHandler))
+
+	// ---- RATE LIMIT PLANS ----
+	gatewayMux.Handle("/admin/plans", admin(ratelimit.PlansHandler(rl)))
+	gatewayMux.Handle("/admin/ratelimit/rules", admin(ratelimit.RulesHandler(rl, rulesFile)))
+	gatewayMux.Handle("/admin/ratelimit/health", admin(ratelimit.HealthHandler(rl)))
+
+	// ---- CONFIG ----
+	gatewayMux.Handle("/admin/config", admin(gateway.StatusHandler(router)))
+	gatewayMux.Handle("/admin/config/reload", admin(gateway.ReloadHandler(router)))
+
+	// ---- ADAPTIVE LIMITS ----
+	gatewayMux.Handle("/admin/adaptive", admin(adaptive.Handler(shedder)))
+
+	// ---- UPSTREAM POOLS ----
+	gatewayMux.Handle("/admin/upstreams", admin(upstream.Handler(upstreams)))
+
+	// ---- CIRCUIT BREAKERS ----
+	gatewayMux.Handle("/admin/circuits", admin(circuit.Handler(breakers)))
+
+	// ---- RESPONSE CACHE ----
+	gatewayMux.Handle("/admin/cache/purge", admin(cache.PurgeHandler(responses)))
+
+	// ---- QUOTAS ----
+	gatewayMux.Handle("/admin/quota/{id}", admin(quota.UsageHandler(quotas)))
+
 	// Legacy endpoints for backward compatibility
 	gatewayMux.HandleFunc("/admin/chaos/enable", chaos.EnableHandler)
 	gatewayMux.HandleFunc("/admin/chaos/disable", chaos.DisableHandler)
@@ -146,9 +386,13 @@ func main() {
 	log.Println("===============================================")
 	log.Println("")
 	log.Println("📊 ENDPOINTS:")
-	log.Println("  GET  /users                    → Proxied to localhost:9001")
-	log.Println("  GET  /orders                   → Proxied to localhost:9002")
-	log.Println("  GET  /admin/analytics          → Analytics data")
+	for _, route := range cfg.Routes {
+		if route.Handler != "" {
+			log.Printf("  %-30s → %s (built-in)", route.Pattern(), route.Handler)
+		} else {
+			log.Printf("  %-30s → Proxied to %s", route.Pattern(), route.Upstream)
+		}
+	}
 	log.Println("  GET  /admin/metrics            → Prometheus metrics (Grafana)")
 	log.Println("")
 	log.Println("⚡ CHAOS CONTROL:")
@@ -156,6 +400,24 @@ func main() {
 	log.Println("  POST /admin/chaos/recover      → Disable all chaos")
 	log.Println("  GET  /admin/chaos/status       → Current chaos state + stats")
 	log.Println("")
+	log.Println("🏢 TENANT ADMIN:")
+	log.Println("  GET  /admin/tenants            → List tenants")
+	log.Println("  POST /admin/tenants            → Create tenant")
+	log.Println("  PUT  /admin/tenants/{id}       → Update tenant (DELETE to remove)")
+	log.Println("  POST /admin/tenants/{id}/suspend|resume")
+	log.Println("  POST /admin/tenants/{id}/keys  → Issue API key (DELETE .../keys/{keyID} to revoke)")
+	log.Println("  POST /admin/tenants/{id}/keys/{keyID}/rotate → Rotate key with grace period")
+	log.Println("  GET  /admin/plans              → Rate limit tiers (PUT to change a tier)")
+	log.Println("  GET  /admin/ratelimit/rules    → Stacked rate limit rules (PUT to replace)")
+	log.Println("  GET  /admin/ratelimit/health   → Redis status and failure policy")
+	log.Println("  GET  /admin/quota/{id}         → Daily/monthly quota usage")
+	log.Println("  GET  /admin/adaptive           → Adaptive concurrency limit per backend")
+	log.Println("  GET  /admin/upstreams          → Upstream instances, in-flight and selections")
+	log.Println("  GET  /admin/circuits           → Circuit breakers (POST to force open/closed/auto)")
+	log.Println("  POST /admin/cache/purge        → Drop cached responses by tenant and/or route")
+	log.Println("  GET  /admin/config             → Routing table version and hash")
+	log.Println("  POST /admin/config/reload      → Reload GATEWAY_CONFIG (also on change or SIGHUP)")
+	log.Println("")
 	log.Println("🚀 DEMO:")
 	log.Println("  GET  /demo                     → Interactive chaos demo UI")
 	log.Println("")
@@ -166,8 +428,91 @@ func main() {
 	log.Println("===============================================")
 
 	port := getEnv("PORT", "8080")
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           gatewayMux,
+		ReadHeaderTimeout: getEnvDuration("SERVER_READ_HEADER_TIMEOUT", 10*time.Second),
+		ReadTimeout:       getEnvDuration("SERVER_READ_TIMEOUT", 30*time.Second),
+		WriteTimeout:      getEnvDuration("SERVER_WRITE_TIMEOUT", 60*time.Second),
+		IdleTimeout:       getEnvDuration("SERVER_IDLE_TIMEOUT", 120*time.Second),
+	}
+	warnWriteTimeout(cfg, server.WriteTimeout)
+	router.OnReload(func(cfg *config.Config) (func(), error) {
+		return func() { warnWriteTimeout(cfg, server.WriteTimeout) }, nil
+	})
+
+	// ---- TLS / mTLS ----
+	// TLS_CERT_FILE + TLS_KEY_FILE terminate TLS at the gateway.
+	// TLS_CLIENT_CA_FILE enables client certificates that map to tenants.
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if certFile != "" && keyFile != "" {
+		tlsConfig, err := serverTLSConfig(os.Getenv("TLS_CLIENT_CA_FILE"), getEnv("TLS_CLIENT_AUTH", "request"))
+		if err != nil {
+			log.Fatalf("invalid TLS configuration: %v", err)
+		}
+		server.TLSConfig = tlsConfig
+
+		log.Printf("Starting TLS server on port %s\n", port)
+		log.Fatal(server.ListenAndServeTLS(certFile, keyFile))
+	}
+
 	log.Printf("Starting server on port %s\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, gatewayMux))
+	log.Fatal(server.ListenAndServe())
+}
+
+// serverTLSConfig builds the gateway's TLS settings. With a client CA bundle,
+// clientAuth selects whether certificates are optional ("request", verified
+// when presented) or mandatory ("require").
+func serverTLSConfig(clientCAFile, clientAuth string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if clientCAFile == "" {
+		return cfg, nil
+	}
+
+	pem, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", clientCAFile)
+	}
+	cfg.ClientCAs = pool
+
+	switch clientAuth {
+	case "request":
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown TLS_CLIENT_AUTH %q (want request or require)", clientAuth)
+	}
+	return cfg, nil
+}
+
+// warnWriteTimeout flags route timeouts the server's write timeout would cut
+// off first: such a route never gets its 504
+func warnWriteTimeout(cfg *config.Config, writeTimeout time.Duration) {
+	if writeTimeout <= 0 {
+		return
+	}
+	for _, route := range cfg.Routes {
+		longest := time.Duration(route.Timeout)
+		for _, o := range route.Tenants {
+			longest = max(longest, time.Duration(o.Timeout))
+		}
+		if longest >= writeTimeout {
+			log.Printf("[CONFIG] route %s timeout %s is not below SERVER_WRITE_TIMEOUT %s",
+				route.Pattern(), longest, writeTimeout)
+		}
+	}
+}
+
+// randomPassword is a fresh admin password for runs without ADMIN_PASSWORD
+func randomPassword() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
 }
 
 // getEnv retrieves environment variable or returns default
@@ -178,6 +523,75 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// defaultConfig is the routing table used when GATEWAY_CONFIG is not set
+func defaultConfig() *config.Config {
+	off := false
+	return &config.Config{
+		Upstreams: map[string]config.Upstream{
+			"users":  {URL: getEnv("USER_SERVICE_URL", "http://localhost:9001")},
+			"orders": {URL: getEnv("ORDER_SERVICE_URL", "http://localhost:9002")},
+		},
+		Routes: []config.Route{
+			{Prefix: "/users", Upstream: "users"},
+			{Prefix: "/orders", Upstream: "orders"},
+			{Prefix: "/admin/analytics", Handler: "analytics", Middleware: config.Middleware{Auth: &off, Chaos: &off}},
+		},
+	}
+}
+
+// validateConfig implements `gateway validate-config [file]`: it checks the
+// file (default $GATEWAY_CONFIG, then gateway.yaml) and reports every problem.
+func validateConfig(args []string) int {
+	path := getEnv("GATEWAY_CONFIG", "gateway.yaml")
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: invalid\n%v\n", path, err)
+		return 1
+	}
+	fmt.Printf("%s: OK (%d upstreams, %d routes)\n", path, len(cfg.Upstreams), len(cfg.Routes))
+	return 0
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", key, err)
+	}
+	return n
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", key, err)
+	}
+	return f
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", key, err)
+	}
+	return d
+}
+
 // startUserService starts the mock user service on :9001
 func startUserService() {
 	mux := http.NewServeMux()
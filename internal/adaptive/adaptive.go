@@ -0,0 +1,333 @@
+package adaptive
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/decisionlog"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/middleware"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/proxy"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/tenant"
+)
+
+var (
+	limitGauge = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "api_gateway_adaptive_limit",
+			Help: "Current adaptive concurrency limit by backend",
+		},
+		[]string{"backend"},
+	)
+
+	shedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_adaptive_shed_total",
+			Help: "Total number of requests shed by the adaptive limiter",
+		},
+		[]string{"backend", "priority"},
+	)
+)
+
+// Config tunes the gradient limiter. Every Window the limit is recomputed
+// from the requests that completed in it:
+//
+//	gradient = clamp(Tolerance * baseline latency / window latency, 0.5, 1)
+//	limit    = limit * gradient + sqrt(limit)
+//
+// so the limit grows while latency stays near its baseline and shrinks as
+// the backend slows down. A window with ErrorThreshold or more 5xx cuts the
+// limit by Backoff straight away.
+type Config struct {
+	InitialLimit   int
+	MinLimit       int
+	MaxLimit       int
+	Window         time.Duration
+	MinSamples     int     // fewer completions than this extend the window
+	Tolerance      float64 // latency may reach this multiple of the baseline
+	ErrorThreshold float64 // share of 5xx in a window, 0..1
+	Backoff        float64 // multiplier applied on errors, 0..1
+	Smoothing      float64 // weight of the new limit against the old, 0..1
+}
+
+// DefaultConfig suits backends answering in tens of milliseconds
+var DefaultConfig = Config{
+	InitialLimit:   20,
+	MinLimit:       5,
+	MaxLimit:       500,
+	Window:         time.Second,
+	MinSamples:     10,
+	Tolerance:      2.0,
+	ErrorThreshold: 0.1,
+	Backoff:        0.7,
+	Smoothing:      0.5,
+}
+
+// share is the fraction of a backend's limit a tenant priority may fill.
+// Keeping headroom above low-priority traffic means that as the limit
+// shrinks they are shed first and high priority tenants last.
+func share(priority int) float64 {
+	switch {
+	case priority < 0:
+		return 0.5
+	case priority == 0:
+		return 0.8
+	default:
+		return 1.0
+	}
+}
+
+func priorityLabel(priority int) string {
+	switch {
+	case priority < 0:
+		return "low"
+	case priority == 0:
+		return "normal"
+	default:
+		return "high"
+	}
+}
+
+// Limiter sheds load per backend once the backend's adaptive concurrency
+// limit is reached. It learns from middleware.Metrics through Observe.
+type Limiter struct {
+	cfg Config
+
+	mu       sync.Mutex
+	backends map[string]*backend
+}
+
+func NewLimiter(cfg Config) *Limiter {
+	return &Limiter{cfg: cfg, backends: make(map[string]*backend)}
+}
+
+// backend is the limiter state for one route prefix
+type backend struct {
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	baseline float64 // long-term latency average, ms
+	shed     uint64
+
+	// current window
+	windowStart time.Time
+	samples     int
+	errors      int
+	sumLatency  float64
+	peak        int
+
+	// last completed window, for reporting
+	latency   float64
+	errorRate float64
+}
+
+func (l *Limiter) backend(name string) *backend {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.backends[name]
+	if !ok {
+		b = &backend{limit: float64(l.cfg.InitialLimit), windowStart: time.Now()}
+		l.backends[name] = b
+		limitGauge.WithLabelValues(name).Set(b.limit)
+	}
+	return b
+}
+
+func (b *backend) acquire(priority int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if float64(b.inFlight) >= math.Max(1, b.limit*share(priority)) {
+		b.shed++
+		return false
+	}
+	b.inFlight++
+	b.peak = max(b.peak, b.inFlight)
+	return true
+}
+
+func (b *backend) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.inFlight--
+}
+
+// Observe feeds one completed request into the backend's limit; it is
+// registered with middleware.AddObserver.
+func (l *Limiter) Observe(name string, status int, duration time.Duration) {
+	l.mu.Lock()
+	b, ok := l.backends[name]
+	l.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.samples++
+	b.sumLatency += float64(duration) / float64(time.Millisecond)
+	if status >= 500 {
+		b.errors++
+	}
+	if time.Since(b.windowStart) < l.cfg.Window || b.samples < l.cfg.MinSamples {
+		return
+	}
+
+	old := b.limit
+	b.recompute(l.cfg)
+	limitGauge.WithLabelValues(name).Set(b.limit)
+	if b.limit < old*0.9 {
+		log.Printf("[ADAPTIVE] backend=%s limit %.0f -> %.0f (latency_ms=%.1f baseline_ms=%.1f error_rate=%.2f)",
+			name, old, b.limit, b.latency, b.baseline, b.errorRate)
+	}
+}
+
+// recompute closes the current window; called with mu held
+func (b *backend) recompute(cfg Config) {
+	latency := b.sumLatency / float64(b.samples)
+	errorRate := float64(b.errors) / float64(b.samples)
+	if b.baseline == 0 {
+		b.baseline = latency
+	}
+
+	var next float64
+	if errorRate >= cfg.ErrorThreshold {
+		next = b.limit * cfg.Backoff
+	} else {
+		gradient := math.Max(0.5, math.Min(1, cfg.Tolerance*b.baseline/math.Max(latency, 0.001)))
+		next = b.limit * gradient
+		// Only grow when traffic actually used the limit; an idle backend
+		// proves nothing about how much more it could take.
+		if float64(b.peak) >= b.limit/2 {
+			next += math.Sqrt(b.limit)
+		}
+		next = (1-cfg.Smoothing)*b.limit + cfg.Smoothing*next
+	}
+	b.limit = math.Max(float64(cfg.MinLimit), math.Min(float64(cfg.MaxLimit), next))
+
+	// The baseline follows lasting changes slowly, so a backend that is
+	// permanently slower stops being treated as degraded.
+	b.baseline = 0.95*b.baseline + 0.05*latency
+
+	b.latency, b.errorRate = latency, errorRate
+	b.windowStart = time.Now()
+	b.samples, b.errors, b.sumLatency = 0, 0, 0
+	b.peak = b.inFlight
+}
+
+// ErrorResponse is the JSON body sent with a 503 when a request is shed
+type ErrorResponse struct {
+	Error      string `json:"error"`
+	Message    string `json:"message"`
+	Backend    string `json:"backend"`
+	RetryAfter int    `json:"retry_after_sec"`
+}
+
+// Middleware admits a request while its backend has room for the tenant's
+// priority and marks it for observation. It belongs directly in front of the
+// backend handler so that only forwarded requests are measured.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, ok := proxy.RouteFromContext(r.Context())
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		priority := 0
+		tenantID := ""
+		if t, ok := tenant.FromContext(r.Context()); ok {
+			priority, tenantID = t.Priority, t.ID
+		}
+
+		b := l.backend(route)
+		if !b.acquire(priority) {
+			shedTotal.WithLabelValues(route, priorityLabel(priority)).Inc()
+			b.mu.Lock()
+			limit, inFlight := b.limit, b.inFlight
+			b.mu.Unlock()
+			decisionlog.LogDecision(r, decisionlog.DecisionBlock, "Load shed", map[string]any{
+				"tenant":    tenantID,
+				"backend":   route,
+				"priority":  priority,
+				"limit":     math.Round(limit),
+				"in_flight": inFlight,
+			})
+
+			w.Header().Set("Retry-After", "1")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(ErrorResponse{
+				Error:      "load_shed",
+				Message:    "Backend is overloaded, please retry",
+				Backend:    route,
+				RetryAfter: 1,
+			})
+			return
+		}
+		defer b.release()
+
+		if obs, ok := middleware.ObservationFromContext(r.Context()); ok {
+			obs.Backend = route
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// BackendStatus describes one backend's adaptive limit
+type BackendStatus struct {
+	Backend    string  `json:"backend"`
+	Limit      int     `json:"limit"`
+	InFlight   int     `json:"in_flight"`
+	LatencyMs  float64 `json:"latency_ms"`
+	BaselineMs float64 `json:"baseline_ms"`
+	ErrorRate  float64 `json:"error_rate"`
+	Shed       uint64  `json:"shed"`
+}
+
+// Status returns every backend seen so far
+func (l *Limiter) Status() []BackendStatus {
+	l.mu.Lock()
+	names := make([]string, 0, len(l.backends))
+	for name := range l.backends {
+		names = append(names, name)
+	}
+	l.mu.Unlock()
+	sort.Strings(names)
+
+	out := make([]BackendStatus, 0, len(names))
+	for _, name := range names {
+		b := l.backend(name)
+		b.mu.Lock()
+		out = append(out, BackendStatus{
+			Backend:    name,
+			Limit:      int(math.Round(b.limit)),
+			InFlight:   b.inFlight,
+			LatencyMs:  b.latency,
+			BaselineMs: b.baseline,
+			ErrorRate:  b.errorRate,
+			Shed:       b.shed,
+		})
+		b.mu.Unlock()
+	}
+	return out
+}
+
+// Handler handles GET /admin/adaptive
+func Handler(l *Limiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(l.Status())
+	}
+}
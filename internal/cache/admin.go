@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/decisionlog"
+)
+
+// PurgeRequest is the body of POST /admin/cache/purge. Route is a route's
+// pattern as configured, e.g. /users or /users/{id}.
+type PurgeRequest struct {
+	Tenant string `json:"tenant,omitempty"`
+	Route  string `json:"route,omitempty"`
+}
+
+// PurgeResponse reports how many entries were dropped
+type PurgeResponse struct {
+	PurgeRequest
+	Purged int `json:"purged"`
+}
+
+// PurgeHandler handles POST /admin/cache/purge: drops the cached responses
+// of a tenant, of a route, or of a tenant on a route
+func PurgeHandler(c *Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req PurgeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if req.Tenant == "" && req.Route == "" {
+			http.Error(w, "tenant or route is required", http.StatusBadRequest)
+			return
+		}
+
+		n, err := c.Purge(r.Context(), req.Tenant, req.Route)
+		if err != nil {
+			http.Error(w, "Purge failed: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		decisionlog.LogDecision(r, decisionlog.DecisionConfig, "Cache purged", map[string]any{
+			"tenant": req.Tenant,
+			"route":  req.Route,
+			"purged": n,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(PurgeResponse{PurgeRequest: req, Purged: n})
+	}
+}
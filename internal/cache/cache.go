@@ -0,0 +1,301 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/proxy"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/tenant"
+)
+
+var lookupsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "api_gateway_cache_requests_total",
+		Help: "Total number of cacheable requests by route and result (hit, stale, revalidated, miss, bypass)",
+	},
+	[]string{"route", "result"},
+)
+
+// Results reported in X-Cache and the metrics
+const (
+	ResultHit         = "HIT"
+	ResultStale       = "STALE"
+	ResultRevalidated = "REVALIDATED"
+	ResultMiss        = "MISS"
+	ResultBypass      = "BYPASS"
+)
+
+const (
+	// maxBody is the largest response body that is stored
+	maxBody = 1 << 20
+
+	// retention keeps entries with an ETag or Last-Modified past their stale
+	// window, so they can still be revalidated with a conditional request
+	retention = time.Hour
+
+	// refreshTimeout bounds a background stale-while-revalidate refresh
+	refreshTimeout = 30 * time.Second
+)
+
+// Policy is a route's caching. TTL replaces the freshness lifetime the
+// upstream gives in Cache-Control or Expires; StaleWhileRevalidate replaces
+// its stale-while-revalidate. Zero keeps the upstream's value.
+type Policy struct {
+	TTL                  time.Duration
+	StaleWhileRevalidate time.Duration
+}
+
+// entry is a stored response. An entry without a status is a marker saying
+// the response varies on the Vary headers; the variants have keys of their
+// own.
+type entry struct {
+	Tenant string `json:"tenant"`
+	Route  string `json:"route"`
+
+	Status int         `json:"status,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+	Vary   []string    `json:"vary,omitempty"`
+
+	Stored     time.Time `json:"stored"` // less the upstream's Age
+	FreshUntil time.Time `json:"fresh_until"`
+	StaleUntil time.Time `json:"stale_until"`
+}
+
+// validated reports whether the entry can be revalidated conditionally
+func (e *entry) validated() bool {
+	return e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != ""
+}
+
+// ttl is how long the store keeps the entry
+func (e *entry) ttl(now time.Time) time.Duration {
+	ttl := e.StaleUntil.Sub(now)
+	if e.validated() {
+		ttl += retention
+	}
+	return ttl
+}
+
+// store keeps entries by key
+type store interface {
+	// get returns nil without an error on a miss
+	get(ctx context.Context, key string) (*entry, error)
+	set(ctx context.Context, key string, e *entry, ttl time.Duration) error
+	// purge drops the entries of tenant on route; empty matches any
+	purge(ctx context.Context, tenant, route string) (int, error)
+}
+
+// Cache stores upstream responses per tenant. Keys always include the
+// tenant ID, so one tenant's responses are never served to another.
+type Cache struct {
+	store store
+
+	refreshing sync.Map // key -> struct{}, background refreshes in flight
+}
+
+// NewLocal keeps up to maxEntries responses, taking up to about maxBytes,
+// in this process, evicting the least recently used; zero means no bound
+func NewLocal(maxEntries, maxBytes int) *Cache {
+	return &Cache{store: newLocalStore(maxEntries, maxBytes)}
+}
+
+// NewRedis shares the cache across replicas
+func NewRedis(redis *redis.Client) *Cache {
+	return &Cache{store: newRedisStore(redis)}
+}
+
+// Purge drops every entry of tenant on route (the route's pattern as
+// configured); an empty tenant or route matches any
+func (c *Cache) Purge(ctx context.Context, tenant, route string) (int, error) {
+	return c.store.purge(ctx, tenant, route)
+}
+
+// key is where the response to r is stored: tenant, route, host and request
+// URI. Tenant and route are escaped so neither can contain the separator.
+func key(tenantID, route string, r *http.Request) string {
+	return url.QueryEscape(tenantID) + ":" + url.QueryEscape(route) + ":" + url.QueryEscape(r.Host) + ":" + r.URL.RequestURI()
+}
+
+// variantKey extends key with the values of the Vary headers
+func variantKey(key string, vary []string, r *http.Request) string {
+	h := sha256.New()
+	for _, name := range vary {
+		h.Write([]byte(strings.Join(r.Header.Values(name), ",")))
+		h.Write([]byte{0})
+	}
+	return key + "|" + hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// lookup returns the stored response to r, following a Vary marker
+func (c *Cache) lookup(ctx context.Context, key string, r *http.Request) (*entry, error) {
+	e, err := c.store.get(ctx, key)
+	if err != nil || e == nil || e.Status != 0 {
+		return e, err
+	}
+	return c.store.get(ctx, variantKey(key, e.Vary, r))
+}
+
+// save stores e as the response to r, behind a Vary marker when it varies
+func (c *Cache) save(ctx context.Context, key string, e *entry, r *http.Request) {
+	ttl := e.ttl(time.Now())
+	if ttl <= 0 {
+		return
+	}
+	if len(e.Vary) > 0 {
+		marker := &entry{Tenant: e.Tenant, Route: e.Route, Vary: e.Vary}
+		if err := c.store.set(ctx, key, marker, ttl); err != nil {
+			log.Printf("[CACHE] store failed: %v", err)
+			return
+		}
+		key = variantKey(key, e.Vary, r)
+	}
+	if err := c.store.set(ctx, key, e, ttl); err != nil {
+		log.Printf("[CACHE] store failed: %v", err)
+	}
+}
+
+// Middleware serves GETs from the cache under policy. Fresh entries are
+// served as they are; stale ones within the stale-while-revalidate window
+// are served while a background request refreshes them; older ones with a
+// validator are revalidated with If-None-Match/If-Modified-Since first.
+func (c *Cache) Middleware(policy Policy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, _ := proxy.RouteFromContext(r.Context())
+		requested := parseCacheControl(r.Header)
+		if r.Method != http.MethodGet || r.Header.Get("Range") != "" || requested.has("no-store") {
+			lookupsTotal.WithLabelValues(route, ResultBypass).Inc()
+			w.Header().Set("X-Cache", ResultBypass)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var tenantID string
+		if t, ok := tenant.FromContext(r.Context()); ok {
+			tenantID = t.ID
+		}
+		key := key(tenantID, route, r)
+
+		var cached *entry
+		if !requested.has("no-cache") {
+			var err error
+			if cached, err = c.lookup(r.Context(), key, r); err != nil {
+				log.Printf("[CACHE] lookup failed, treating as a miss: %v", err)
+			}
+		}
+
+		now := time.Now()
+		switch {
+		case cached != nil && now.Before(cached.FreshUntil):
+			lookupsTotal.WithLabelValues(route, ResultHit).Inc()
+			serve(w, r, cached, ResultHit)
+			return
+		case cached != nil && now.Before(cached.StaleUntil):
+			lookupsTotal.WithLabelValues(route, ResultStale).Inc()
+			serve(w, r, cached, ResultStale)
+			c.refresh(r, key, tenantID, route, cached, policy, next)
+			return
+		case cached != nil && !cached.validated():
+			cached = nil
+		}
+
+		result := c.fetch(w, r, key, tenantID, route, cached, policy, next)
+		lookupsTotal.WithLabelValues(route, result).Inc()
+	})
+}
+
+// fetch forwards r, conditionally when cached is set, stores what the
+// upstream answers and reports the result
+func (c *Cache) fetch(w http.ResponseWriter, r *http.Request, key, tenantID, route string, cached *entry, policy Policy, next http.Handler) string {
+	out := r
+	if cached != nil {
+		out = r.Clone(r.Context())
+		out.Header.Del("If-None-Match")
+		out.Header.Del("If-Modified-Since")
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			out.Header.Set("If-None-Match", etag)
+		}
+		if modified := cached.Header.Get("Last-Modified"); modified != "" {
+			out.Header.Set("If-Modified-Since", modified)
+		}
+	}
+
+	rec := &capture{w: w, header: make(http.Header), hold: cached != nil, result: ResultMiss}
+	next.ServeHTTP(rec, out)
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+
+	authorized := r.Header.Get("Authorization") != ""
+	now := time.Now()
+	if rec.held {
+		// 304 to our conditional: the stored body is still good
+		refreshed := *cached
+		refreshed.Header = cached.Header.Clone()
+		for name, values := range rec.header {
+			refreshed.Header[name] = values
+		}
+		if fresh, stale, ok := lifetime(refreshed.Header, policy, authorized); ok {
+			refreshed.Stored = now.Add(-age(rec.header))
+			refreshed.FreshUntil = refreshed.Stored.Add(fresh)
+			refreshed.StaleUntil = refreshed.FreshUntil.Add(stale)
+			c.save(r.Context(), key, &refreshed, r)
+		}
+		serve(w, r, &refreshed, ResultRevalidated)
+		return ResultRevalidated
+	}
+
+	if e := rec.entry(tenantID, route, policy, authorized, now); e != nil {
+		c.save(r.Context(), key, e, r)
+	}
+	return ResultMiss
+}
+
+// refresh revalidates a stale entry in the background, once per key at a
+// time. The refresh outlives the client's request.
+func (c *Cache) refresh(r *http.Request, key, tenantID, route string, cached *entry, policy Policy, next http.Handler) {
+	if _, busy := c.refreshing.LoadOrStore(key, struct{}{}); busy {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), refreshTimeout)
+	out := r.Clone(ctx)
+	if !cached.validated() {
+		cached = nil
+	}
+	go func() {
+		defer cancel()
+		defer c.refreshing.Delete(key)
+		c.fetch(&discard{header: make(http.Header)}, out, key, tenantID, route, cached, policy, next)
+	}()
+}
+
+// serve writes a stored response, or 304 when it matches the client's
+// If-None-Match
+func serve(w http.ResponseWriter, r *http.Request, e *entry, result string) {
+	h := w.Header()
+	for name, values := range e.Header {
+		h[name] = slices.Clone(values)
+	}
+	h.Set("Age", strconv.Itoa(int(time.Since(e.Stored)/time.Second)))
+	h.Set("X-Cache", result)
+
+	if etag := e.Header.Get("ETag"); etag != "" && etagMatch(r.Header.Get("If-None-Match"), etag) {
+		h.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(e.Status)
+	w.Write(e.Body)
+}
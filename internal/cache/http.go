@@ -0,0 +1,244 @@
+package cache
+
+import (
+	"bytes"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheControl holds Cache-Control directives, lowercased, with their
+// values ("" for directives without one)
+type cacheControl map[string]string
+
+func parseCacheControl(h http.Header) cacheControl {
+	cc := make(cacheControl)
+	for _, line := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(line, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name == "" {
+				continue
+			}
+			cc[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+// seconds returns a directive's value in seconds
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	v, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// storable statuses, those cacheable by default (RFC 9110 15.1) that a
+// gateway serves in practice
+var storable = []int{
+	http.StatusOK,
+	http.StatusNonAuthoritativeInfo,
+	http.StatusNoContent,
+	http.StatusMultipleChoices,
+	http.StatusMovedPermanently,
+	http.StatusNotFound,
+	http.StatusGone,
+}
+
+// lifetime returns how long a response with header h stays fresh and how
+// long it may then be served stale while revalidating; false means it must
+// not be stored. no-cache responses are stored with no freshness, so every
+// use revalidates them. A response to a request with an Authorization
+// header is only stored when it is marked public or has s-maxage (RFC 9111
+// section 3.5).
+func lifetime(h http.Header, policy Policy, authorized bool) (fresh, stale time.Duration, ok bool) {
+	cc := parseCacheControl(h)
+	if cc.has("no-store") || cc.has("private") || h.Get("Set-Cookie") != "" || h.Get("Vary") == "*" {
+		return 0, 0, false
+	}
+	if authorized && !cc.has("public") && !cc.has("s-maxage") {
+		return 0, 0, false
+	}
+
+	explicit := true
+	switch s, ok := cc.seconds("s-maxage"); {
+	case ok:
+		fresh = s
+	default:
+		if m, ok := cc.seconds("max-age"); ok {
+			fresh = m
+		} else if expires, err := http.ParseTime(h.Get("Expires")); err == nil {
+			date, err := http.ParseTime(h.Get("Date"))
+			if err != nil {
+				date = time.Now()
+			}
+			fresh = max(expires.Sub(date), 0)
+		} else {
+			explicit = false
+		}
+	}
+	if policy.TTL > 0 {
+		fresh, explicit = policy.TTL, true
+	}
+	if cc.has("no-cache") {
+		fresh = 0
+	}
+	if !explicit && !cc.has("no-cache") {
+		return 0, 0, false
+	}
+
+	stale, _ = cc.seconds("stale-while-revalidate")
+	if policy.StaleWhileRevalidate > 0 {
+		stale = policy.StaleWhileRevalidate
+	}
+	if cc.has("no-cache") || cc.has("must-revalidate") || cc.has("proxy-revalidate") {
+		stale = 0
+	}
+	return fresh, stale, true
+}
+
+// age is the upstream's Age header
+func age(h http.Header) time.Duration {
+	n, err := strconv.Atoi(h.Get("Age"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
+// etagMatch reports whether an If-None-Match list matches etag, comparing
+// weakly
+func etagMatch(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// varyHeaders lists the canonical header names of Vary
+func varyHeaders(h http.Header) []string {
+	var names []string
+	for _, line := range h.Values("Vary") {
+		for _, name := range strings.Split(line, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// capture passes the upstream's response on to the client while keeping a
+// copy to store. Its own header map keeps headers set further out (rate
+// limit, quota) out of the stored copy. With hold set, a 304 answering the
+// cache's own conditional request is kept from the client.
+type capture struct {
+	w      http.ResponseWriter
+	header http.Header
+	hold   bool
+	result string // X-Cache sent with a passed-on response
+
+	status   int
+	held     bool
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (c *capture) Header() http.Header {
+	return c.header
+}
+
+func (c *capture) WriteHeader(status int) {
+	if c.status != 0 {
+		return
+	}
+	c.status = status
+	if status == http.StatusNotModified && c.hold {
+		c.held = true
+		return
+	}
+	h := c.w.Header()
+	for name, values := range c.header {
+		h[name] = values
+	}
+	h.Set("X-Cache", c.result)
+	c.w.WriteHeader(status)
+}
+
+func (c *capture) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if !c.overflow {
+		if c.body.Len()+len(b) > maxBody {
+			c.overflow = true
+			c.body = bytes.Buffer{}
+		} else {
+			c.body.Write(b)
+		}
+	}
+	if c.held {
+		return len(b), nil
+	}
+	return c.w.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the client's writer to flush
+func (c *capture) Unwrap() http.ResponseWriter {
+	return c.w
+}
+
+// entry is the captured response as an entry, nil when it must not be
+// stored
+func (c *capture) entry(tenantID, route string, policy Policy, authorized bool, now time.Time) *entry {
+	if c.overflow || !slices.Contains(storable, c.status) {
+		return nil
+	}
+	fresh, stale, ok := lifetime(c.header, policy, authorized)
+	if !ok {
+		return nil
+	}
+	e := &entry{
+		Tenant: tenantID,
+		Route:  route,
+		Status: c.status,
+		Header: c.header.Clone(),
+		Body:   bytes.Clone(c.body.Bytes()),
+		Vary:   varyHeaders(c.header),
+		Stored: now.Add(-age(c.header)),
+	}
+	e.Header.Del("Age")
+	e.Header.Del("X-Cache")
+	e.FreshUntil = e.Stored.Add(fresh)
+	e.StaleUntil = e.FreshUntil.Add(stale)
+	return e
+}
+
+// discard is where a background refresh writes its response
+type discard struct {
+	header http.Header
+}
+
+func (d *discard) Header() http.Header         { return d.header }
+func (d *discard) WriteHeader(int)             {}
+func (d *discard) Write(b []byte) (int, error) { return len(b), nil }
@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// localStore is an in-memory LRU of entries, bounded by count and by size
+type localStore struct {
+	max      int
+	maxBytes int
+
+	mu      sync.Mutex
+	order   *list.List // front is the most recently used
+	entries map[string]*list.Element
+	bytes   int // size of the stored items
+}
+
+type localItem struct {
+	key     string
+	entry   *entry
+	expires time.Time
+	size    int
+}
+
+func newLocalStore(maxEntries, maxBytes int) *localStore {
+	return &localStore{max: maxEntries, maxBytes: maxBytes, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// itemSize approximates the memory an item holds: key, body and headers
+func itemSize(key string, e *entry) int {
+	n := len(key) + len(e.Body)
+	for name, values := range e.Header {
+		n += len(name)
+		for _, v := range values {
+			n += len(v)
+		}
+	}
+	return n
+}
+
+func (s *localStore) get(_ context.Context, key string) (*entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	item := el.Value.(*localItem)
+	if time.Now().After(item.expires) {
+		s.remove(el)
+		return nil, nil
+	}
+	s.order.MoveToFront(el)
+	return item.entry, nil
+}
+
+func (s *localStore) set(_ context.Context, key string, e *entry, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item := &localItem{key: key, entry: e, expires: time.Now().Add(ttl), size: itemSize(key, e)}
+	if s.maxBytes > 0 && item.size > s.maxBytes {
+		// Would evict everything else and still not fit; drop the version it
+		// replaces
+		if el, ok := s.entries[key]; ok {
+			s.remove(el)
+		}
+		return nil
+	}
+	if el, ok := s.entries[key]; ok {
+		s.bytes -= el.Value.(*localItem).size
+		el.Value = item
+		s.order.MoveToFront(el)
+	} else {
+		s.entries[key] = s.order.PushFront(item)
+	}
+	s.bytes += item.size
+	for (s.max > 0 && s.order.Len() > s.max) || (s.maxBytes > 0 && s.bytes > s.maxBytes) {
+		s.remove(s.order.Back())
+	}
+	return nil
+}
+
+func (s *localStore) purge(_ context.Context, tenant, route string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, el := range s.entries {
+		e := el.Value.(*localItem).entry
+		if (tenant == "" || e.Tenant == tenant) && (route == "" || e.Route == route) {
+			s.remove(el)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// remove drops el; the caller holds mu
+func (s *localStore) remove(el *list.Element) {
+	item := el.Value.(*localItem)
+	s.order.Remove(el)
+	delete(s.entries, item.key)
+	s.bytes -= item.size
+}
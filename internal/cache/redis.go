@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keyPrefix namespaces the cache in Redis
+const keyPrefix = "gateway:cache:"
+
+// redisStore keeps entries as JSON strings that expire with their ttl
+type redisStore struct {
+	redis *redis.Client
+}
+
+func newRedisStore(redis *redis.Client) *redisStore {
+	return &redisStore{redis: redis}
+}
+
+func (s *redisStore) get(ctx context.Context, key string) (*entry, error) {
+	data, err := s.redis.Get(ctx, keyPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (s *redisStore) set(ctx context.Context, key string, e *entry, ttl time.Duration) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.redis.Set(ctx, keyPrefix+key, data, ttl).Err()
+}
+
+// purge scans for the matching keys. Tenant and route are escaped in keys,
+// so they cannot contain glob characters.
+func (s *redisStore) purge(ctx context.Context, tenant, route string) (int, error) {
+	pattern := keyPrefix + globSegment(tenant) + ":" + globSegment(route) + ":*"
+	n := 0
+	iter := s.redis.Scan(ctx, 0, pattern, 500).Iterator()
+	var batch []string
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		deleted, err := s.redis.Unlink(ctx, batch...).Result()
+		n += int(deleted)
+		batch = batch[:0]
+		return err
+	}
+	for iter.Next(ctx) {
+		if batch = append(batch, iter.Val()); len(batch) == 500 {
+			if err := flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return n, err
+	}
+	return n, flush()
+}
+
+// globSegment matches one escaped key segment, any when s is empty
+func globSegment(s string) string {
+	if s == "" {
+		return "*"
+	}
+	return url.QueryEscape(s)
+}
@@ -1,6 +1,8 @@
 package chaos
 
 import (
+	"context"
+	"errors"
 	"math/rand"
 	"net/http"
 	"time"
@@ -30,7 +32,20 @@ func Middleware(next http.Handler) http.Handler {
 				"delay_ms":   cfg.Delay.Milliseconds(),
 				"chaos_type": "SLOW_MODE",
 			})
-			time.Sleep(cfg.Delay)
+			// The delay counts against the request's deadline like real latency
+			timer := time.NewTimer(cfg.Delay)
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				timer.Stop()
+				if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+					decisionlog.LogDecision(r, decisionlog.DecisionBlock, "Request deadline exceeded", map[string]any{
+						"during": "injected latency",
+					})
+					w.WriteHeader(http.StatusGatewayTimeout)
+				}
+				return
+			}
 		}
 
 		// Inject errors
@@ -0,0 +1,128 @@
+package circuit
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/decisionlog"
+)
+
+// Status describes one breaker in /admin/circuits
+type Status struct {
+	Breaker  string    `json:"breaker"`
+	State    State     `json:"state"`
+	Forced   bool      `json:"forced"`
+	Since    time.Time `json:"since"`
+	Requests int       `json:"window_requests"`
+	Failures int       `json:"window_failures"`
+	Rejected uint64    `json:"rejected"`
+}
+
+// Status returns every breaker seen so far, sorted by name
+func (bs *Breakers) Status() []Status {
+	bs.mu.Lock()
+	names := make([]string, 0, len(bs.breakers))
+	for name := range bs.breakers {
+		names = append(names, name)
+	}
+	bs.mu.Unlock()
+	sort.Strings(names)
+
+	out := make([]Status, 0, len(names))
+	for _, name := range names {
+		b, _ := bs.lookup(name)
+		b.mu.Lock()
+		out = append(out, Status{
+			Breaker:  name,
+			State:    b.effective(),
+			Forced:   b.forced != nil,
+			Since:    b.changed,
+			Requests: b.requests,
+			Failures: b.failures,
+			Rejected: b.rejected,
+		})
+		b.mu.Unlock()
+	}
+	return out
+}
+
+// Force pins a breaker open or closed; nil hands it back to the automatic
+// state machine, starting closed. It reports false for a breaker that has
+// not seen any traffic yet.
+func (bs *Breakers) Force(name string, state *State) bool {
+	b, ok := bs.lookup(name)
+	if !ok {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.forced = state
+	if state == nil {
+		b.setState(Closed, "forced state cleared")
+		stateGauge.WithLabelValues(name).Set(float64(Closed))
+		log.Printf("[CIRCUIT] %s back to automatic", name)
+		return true
+	}
+	b.changed = time.Now()
+	stateGauge.WithLabelValues(name).Set(float64(*state))
+	log.Printf("[CIRCUIT] %s forced %s", name, *state)
+	return true
+}
+
+// ForceRequest is the body of POST /admin/circuits
+type ForceRequest struct {
+	Breaker string `json:"breaker"`
+	State   string `json:"state"` // open, closed or auto
+}
+
+// Handler handles GET /admin/circuits and POST /admin/circuits to force a
+// breaker
+func Handler(bs *Breakers) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var req ForceRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			if req.Breaker == "" {
+				http.Error(w, "breaker is required", http.StatusBadRequest)
+				return
+			}
+
+			var state *State
+			switch req.State {
+			case "open":
+				s := Open
+				state = &s
+			case "closed":
+				s := Closed
+				state = &s
+			case "auto":
+			default:
+				http.Error(w, "state must be open, closed or auto", http.StatusBadRequest)
+				return
+			}
+			if !bs.Force(req.Breaker, state) {
+				http.Error(w, "unknown breaker", http.StatusNotFound)
+				return
+			}
+			decisionlog.LogDecision(r, decisionlog.DecisionConfig, "Circuit breaker forced", map[string]any{
+				"breaker": req.Breaker,
+				"state":   req.State,
+			})
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(bs.Status())
+	}
+}
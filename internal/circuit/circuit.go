@@ -0,0 +1,345 @@
+package circuit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/decisionlog"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/proxy"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/tenant"
+)
+
+var (
+	stateGauge = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "api_gateway_circuit_state",
+			Help: "Circuit breaker state by breaker (0 closed, 1 half-open, 2 open)",
+		},
+		[]string{"breaker"},
+	)
+
+	rejectedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_circuit_rejected_total",
+			Help: "Total number of requests rejected by an open circuit breaker",
+		},
+		[]string{"breaker"},
+	)
+)
+
+// State is a breaker's position
+type State int
+
+const (
+	Closed State = iota
+	HalfOpen
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case HalfOpen:
+		return "half_open"
+	case Open:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+func (s State) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// Config tunes every breaker. A closed breaker opens once a window has seen
+// MinRequests requests of which FailureRatio or more failed (5xx or no
+// answer). After OpenTimeout it lets HalfOpenProbes requests through: all
+// of them succeeding closes it, any failure opens it again.
+type Config struct {
+	FailureRatio   float64
+	MinRequests    int
+	Window         time.Duration
+	OpenTimeout    time.Duration
+	HalfOpenProbes int
+}
+
+var DefaultConfig = Config{
+	FailureRatio:   0.5,
+	MinRequests:    20,
+	Window:         10 * time.Second,
+	OpenTimeout:    30 * time.Second,
+	HalfOpenProbes: 5,
+}
+
+// Breaker is one circuit, for an upstream or a tenant-route pair
+type Breaker struct {
+	name string
+	cfg  Config
+
+	mu       sync.Mutex
+	state    State
+	forced   *State // set by an admin, overrides the automatic state
+	changed  time.Time
+	rejected uint64
+
+	// closed: the current window
+	windowStart time.Time
+	requests    int
+	failures    int
+
+	// half-open: probes let through and probes that came back fine
+	probes    int
+	successes int
+}
+
+func newBreaker(name string, cfg Config) *Breaker {
+	now := time.Now()
+	stateGauge.WithLabelValues(name).Set(float64(Closed))
+	return &Breaker{name: name, cfg: cfg, changed: now, windowStart: now}
+}
+
+// setState moves the automatic state; called with mu held
+func (b *Breaker) setState(s State, why string) {
+	if b.state == s {
+		return
+	}
+	log.Printf("[CIRCUIT] %s %s -> %s (%s)", b.name, b.state, s, why)
+	b.state = s
+	b.changed = time.Now()
+	b.windowStart = b.changed
+	b.requests, b.failures, b.probes, b.successes = 0, 0, 0, 0
+	if b.forced == nil {
+		stateGauge.WithLabelValues(b.name).Set(float64(s))
+	}
+}
+
+// allow reports whether a request may pass. A true result must be followed
+// by exactly one record or cancel.
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.forced != nil {
+		if *b.forced == Open {
+			b.rejected++
+			return false
+		}
+		return true
+	}
+
+	if b.state == Open && time.Since(b.changed) >= b.cfg.OpenTimeout {
+		b.setState(HalfOpen, "open timeout elapsed")
+	}
+	switch b.state {
+	case Open:
+		b.rejected++
+		return false
+	case HalfOpen:
+		if b.probes >= b.cfg.HalfOpenProbes {
+			b.rejected++
+			return false
+		}
+		b.probes++
+	}
+	return true
+}
+
+// cancel returns a probe slot taken by allow for a request that was not
+// sent after all, or whose client went away before it was answered
+func (b *Breaker) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.forced == nil && b.state == HalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// record feeds back the outcome of a request allow let through
+func (b *Breaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.forced != nil {
+		return
+	}
+
+	switch b.state {
+	case HalfOpen:
+		if failed {
+			b.setState(Open, "probe failed")
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenProbes {
+			b.setState(Closed, "probes succeeded")
+		}
+	case Closed:
+		if time.Since(b.windowStart) >= b.cfg.Window {
+			b.windowStart = time.Now()
+			b.requests, b.failures = 0, 0
+		}
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= b.cfg.MinRequests && float64(b.failures) >= b.cfg.FailureRatio*float64(b.requests) {
+			b.setState(Open, strconv.Itoa(b.failures)+"/"+strconv.Itoa(b.requests)+" requests failed")
+		}
+	}
+}
+
+// effective is the state requests see; called with mu held
+func (b *Breaker) effective() State {
+	if b.forced != nil {
+		return *b.forced
+	}
+	if b.state == Open && time.Since(b.changed) >= b.cfg.OpenTimeout {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// retryAfter is how long until an open breaker starts probing
+func (b *Breaker) retryAfter() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.forced != nil || b.state != Open {
+		return 1
+	}
+	return max(1, int(math.Ceil((b.cfg.OpenTimeout - time.Since(b.changed)).Seconds())))
+}
+
+// Breakers holds every breaker, created on first use
+type Breakers struct {
+	cfg Config
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+func New(cfg Config) *Breakers {
+	return &Breakers{cfg: cfg, breakers: make(map[string]*Breaker)}
+}
+
+func (bs *Breakers) get(name string) *Breaker {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	b, ok := bs.breakers[name]
+	if !ok {
+		b = newBreaker(name, bs.cfg)
+		bs.breakers[name] = b
+	}
+	return b
+}
+
+// lookup returns an existing breaker without creating one
+func (bs *Breakers) lookup(name string) (*Breaker, bool) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	b, ok := bs.breakers[name]
+	return b, ok
+}
+
+// ErrorResponse is the JSON body sent with a 503 when a circuit is open
+type ErrorResponse struct {
+	Error      string `json:"error"`
+	Message    string `json:"message"`
+	Breaker    string `json:"breaker"`
+	RetryAfter int    `json:"retry_after_sec"`
+}
+
+// statusRecorder captures the status the upstream answered with
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Middleware guards an upstream with two breakers: "upstream:<name>", shared
+// by every route and tenant, and "tenant:<id>:route:<pattern>", which trips
+// on failures only one tenant sees on one route without waiting for the
+// whole upstream to degrade. It belongs directly in front of the proxy so
+// only upstream answers count.
+func (bs *Breakers) Middleware(upstream string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		breakers := []*Breaker{bs.get("upstream:" + upstream)}
+		if t, ok := tenant.FromContext(r.Context()); ok {
+			if route, ok := proxy.RouteFromContext(r.Context()); ok {
+				breakers = append(breakers, bs.get("tenant:"+t.ID+":route:"+route))
+			}
+		}
+
+		for i, b := range breakers {
+			if b.allow() {
+				continue
+			}
+			for _, earlier := range breakers[:i] {
+				earlier.cancel()
+			}
+			rejectedTotal.WithLabelValues(b.name).Inc()
+			retry := b.retryAfter()
+			decisionlog.LogDecision(r, decisionlog.DecisionBlock, "Circuit open", map[string]any{
+				"breaker":  b.name,
+				"upstream": upstream,
+			})
+
+			w.Header().Set("Retry-After", strconv.Itoa(retry))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(ErrorResponse{
+				Error:      "circuit_open",
+				Message:    "Upstream is failing, please retry later",
+				Breaker:    b.name,
+				RetryAfter: retry,
+			})
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		completed := false
+		defer func() {
+			// A client that went away says nothing about the upstream; give
+			// back any probe slot instead
+			if errors.Is(r.Context().Err(), context.Canceled) {
+				for _, b := range breakers {
+					b.cancel()
+				}
+				return
+			}
+			// A panic or a handler that never answered counts as a failure
+			failed := !completed || rec.status == 0 || rec.status >= 500
+			for _, b := range breakers {
+				b.record(failed)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+		completed = true
+	})
+}
@@ -0,0 +1,197 @@
+package coalesce
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/decisionlog"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/middleware"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/proxy"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/tenant"
+)
+
+// maxBody is the largest response that is shared; waiters behind a larger
+// one make their own call
+const maxBody = 1 << 20
+
+// Policy is a route's coalescing. Requests are identical when tenant,
+// method, host, path, query and the values of Headers all match.
+type Policy struct {
+	Headers []string
+}
+
+// call is one upstream request that identical requests wait on
+type call struct {
+	done chan struct{}
+
+	// Set before done is closed; shared is false when the response could
+	// not be handed out (too large, cut off, the leader's client went away,
+	// or meant for the leader alone)
+	shared bool
+	status int
+	header http.Header
+	body   []byte
+}
+
+// group holds the calls in flight by key
+type group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// Middleware collapses concurrent identical GET and HEAD requests into one
+// call to next. The first request (the leader) makes the call and streams
+// the response to its client as usual; requests arriving while it runs wait
+// and get a copy.
+func Middleware(policy Policy, next http.Handler) http.Handler {
+	g := &group{calls: make(map[string]*call)}
+	headers := make([]string, len(policy.Headers))
+	for i, name := range policy.Headers {
+		headers[i] = http.CanonicalHeaderKey(name)
+	}
+	slices.Sort(headers)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		route, _ := proxy.RouteFromContext(r.Context())
+		key := key(r, headers)
+
+		g.mu.Lock()
+		if c, ok := g.calls[key]; ok {
+			g.mu.Unlock()
+			select {
+			case <-c.done:
+			case <-r.Context().Done():
+				return // client gave up while waiting
+			}
+			if c.shared {
+				middleware.RecordCoalesce(route, true)
+				c.write(w)
+				return
+			}
+			decisionlog.LogDecision(r, decisionlog.DecisionRoute, "Coalesced response not shareable, calling upstream", map[string]any{
+				"route": route,
+			})
+			middleware.RecordCoalesce(route, false)
+			next.ServeHTTP(w, r)
+			return
+		}
+		c := &call{done: make(chan struct{})}
+		g.calls[key] = c
+		g.mu.Unlock()
+
+		middleware.RecordCoalesce(route, false)
+		rec := &capture{w: w, header: make(http.Header)}
+		completed := false // false when next panics, e.g. aborting a broken body copy
+		defer func() {
+			g.mu.Lock()
+			delete(g.calls, key)
+			g.mu.Unlock()
+
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			c.shared = completed && !rec.overflow && r.Context().Err() == nil && !personal(rec.header)
+			c.status, c.header, c.body = rec.status, rec.header, rec.body.Bytes()
+			close(c.done)
+		}()
+		next.ServeHTTP(rec, r)
+		completed = true
+	})
+}
+
+// personal reports whether a response is meant for its own client only: it
+// sets a cookie or its Cache-Control forbids sharing
+func personal(h http.Header) bool {
+	if h.Get("Set-Cookie") != "" {
+		return true
+	}
+	for _, line := range h.Values("Cache-Control") {
+		for _, directive := range strings.Split(line, ",") {
+			name, _, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if strings.EqualFold(name, "private") || strings.EqualFold(name, "no-store") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// key identifies identical requests. The tenant and the selected headers'
+// values are escaped so no value can run into the next.
+func key(r *http.Request, headers []string) string {
+	var b strings.Builder
+	if t, ok := tenant.FromContext(r.Context()); ok {
+		b.WriteString(url.QueryEscape(t.ID))
+	}
+	b.WriteString(" " + r.Method + " " + url.QueryEscape(r.Host) + " " + r.URL.RequestURI())
+	for _, name := range headers {
+		b.WriteString(" " + name + "=" + url.QueryEscape(strings.Join(r.Header.Values(name), ",")))
+	}
+	return b.String()
+}
+
+// write sends the shared response
+func (c *call) write(w http.ResponseWriter) {
+	h := w.Header()
+	for name, values := range c.header {
+		h[name] = slices.Clone(values)
+	}
+	w.WriteHeader(c.status)
+	w.Write(c.body)
+}
+
+// capture passes the leader's response on while keeping a copy for the
+// waiters. Its own header map keeps headers set further out (rate limit,
+// quota) for the leader's client out of the copy.
+type capture struct {
+	w      http.ResponseWriter
+	header http.Header
+
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (c *capture) Header() http.Header {
+	return c.header
+}
+
+func (c *capture) WriteHeader(status int) {
+	if c.status != 0 {
+		return
+	}
+	c.status = status
+	h := c.w.Header()
+	for name, values := range c.header {
+		h[name] = values
+	}
+	c.w.WriteHeader(status)
+}
+
+func (c *capture) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if !c.overflow {
+		if c.body.Len()+len(b) > maxBody {
+			c.overflow = true
+			c.body = bytes.Buffer{}
+		} else {
+			c.body.Write(b)
+		}
+	}
+	return c.w.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the client's writer to flush
+func (c *capture) Unwrap() http.ResponseWriter {
+	return c.w
+}
@@ -0,0 +1,164 @@
+package concurrency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/decisionlog"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/proxy"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/tenant"
+	"github.com/redis/go-redis/v9"
+)
+
+// Scopes a slot is held in
+const (
+	ScopeTenant  = "tenant"
+	ScopeBackend = "backend"
+)
+
+// Config sets the in-flight caps. A zero limit disables that scope.
+type Config struct {
+	TenantLimit  int // per tenant, unless the tenant sets MaxInFlight
+	BackendLimit int // per backend (route prefix) across all tenants
+
+	// QueueSize requests may wait for a slot, per tenant or backend, for up
+	// to QueueTimeout; 0 rejects as soon as the limit is reached.
+	QueueSize    int
+	QueueTimeout time.Duration
+
+	// Lease is how long a distributed slot survives without renewal, i.e.
+	// how soon slots held by a crashed replica are reclaimed.
+	Lease time.Duration
+}
+
+// errSaturated means no slot freed up in time (or the queue was full)
+var errSaturated = errors.New("concurrency limit reached")
+
+// semaphores hands out slots keyed by scope and name
+type semaphores interface {
+	// acquire waits for a slot under key; release must be called exactly once
+	// when err is nil.
+	acquire(ctx context.Context, key string, limit int) (release func(), err error)
+}
+
+// Limiter caps the number of requests in flight per tenant and per backend
+type Limiter struct {
+	cfg  Config
+	sems semaphores
+}
+
+// NewLocal counts in-flight requests in this process only
+func NewLocal(cfg Config) *Limiter {
+	return &Limiter{cfg: cfg, sems: newLocalSemaphores(cfg)}
+}
+
+// NewDistributed shares the caps across replicas through Redis sorted-set
+// semaphores whose entries expire unless renewed.
+func NewDistributed(redis *redis.Client, cfg Config) *Limiter {
+	if cfg.Lease <= 0 {
+		cfg.Lease = 30 * time.Second
+	}
+	return &Limiter{cfg: cfg, sems: newRedisSemaphores(redis, cfg)}
+}
+
+// ErrorResponse is the JSON body sent with a 503 when saturated
+type ErrorResponse struct {
+	Error      string `json:"error"`
+	Message    string `json:"message"`
+	Scope      string `json:"scope"`
+	Limit      int    `json:"limit"`
+	RetryAfter int    `json:"retry_after_sec"`
+}
+
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t, ok := tenant.FromContext(r.Context())
+		if !ok {
+			decisionlog.LogDecision(r, decisionlog.DecisionBlock, "Tenant not found for concurrency limiting", nil)
+			http.Error(w, "Tenant not found", http.StatusUnauthorized)
+			return
+		}
+		route, _ := proxy.RouteFromContext(r.Context())
+
+		tenantLimit := l.cfg.TenantLimit
+		if t.MaxInFlight > 0 {
+			tenantLimit = t.MaxInFlight
+		}
+
+		start := time.Now()
+		// Tenant first, so a saturated backend does not hold tenant slots
+		// of requests that never got in.
+		slots := []struct {
+			scope, key string
+			limit      int
+		}{
+			{ScopeTenant, "concurrency:tenant:" + t.ID, tenantLimit},
+			{ScopeBackend, "concurrency:backend:" + route, l.cfg.BackendLimit},
+		}
+		for _, s := range slots {
+			if s.limit <= 0 || (s.scope == ScopeBackend && route == "") {
+				continue
+			}
+
+			release, err := l.sems.acquire(r.Context(), s.key, s.limit)
+			if errors.Is(err, errSaturated) {
+				decisionlog.LogDecision(r, decisionlog.DecisionBlock, "Concurrency limit exceeded", map[string]any{
+					"tenant":    t.ID,
+					"scope":     s.scope,
+					"backend":   route,
+					"limit":     s.limit,
+					"waited_ms": time.Since(start).Milliseconds(),
+				})
+				l.writeSaturated(w, s.scope, s.limit)
+				return
+			}
+			if err != nil {
+				if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+					// The route's timeout ran out while queued
+					decisionlog.LogDecision(r, decisionlog.DecisionBlock, "Request deadline exceeded", map[string]any{
+						"tenant":    t.ID,
+						"scope":     s.scope,
+						"during":    "concurrency queue",
+						"waited_ms": time.Since(start).Milliseconds(),
+					})
+					w.WriteHeader(http.StatusGatewayTimeout)
+					return
+				}
+				if r.Context().Err() != nil {
+					return // client gave up while queued
+				}
+				// Redis trouble should not stop traffic; run unguarded
+				decisionlog.LogDecision(r, decisionlog.DecisionAllow, "Concurrency check skipped, Redis unavailable", map[string]any{
+					"tenant": t.ID,
+					"scope":  s.scope,
+					"error":  err.Error(),
+				})
+				continue
+			}
+			defer release()
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeSaturated answers 503 with a Retry-After of about one queue timeout
+func (l *Limiter) writeSaturated(w http.ResponseWriter, scope string, limit int) {
+	retryAfter := max(int(math.Ceil(l.cfg.QueueTimeout.Seconds())), 1)
+
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error:      "concurrency_limit_exceeded",
+		Message:    "Too many requests in flight for this " + scope,
+		Scope:      scope,
+		Limit:      limit,
+		RetryAfter: retryAfter,
+	})
+}
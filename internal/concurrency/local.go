@@ -0,0 +1,74 @@
+package concurrency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// localSemaphores keeps one counting semaphore per key in memory
+type localSemaphores struct {
+	cfg Config
+
+	mu   sync.Mutex
+	sems map[string]*localSemaphore
+}
+
+type localSemaphore struct {
+	slots   chan struct{} // one buffered element per request in flight
+	waiting int           // guarded by localSemaphores.mu
+}
+
+func newLocalSemaphores(cfg Config) *localSemaphores {
+	return &localSemaphores{cfg: cfg, sems: make(map[string]*localSemaphore)}
+}
+
+func (s *localSemaphores) get(key string, limit int) *localSemaphore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sem, ok := s.sems[key]
+	// A changed limit (e.g. the tenant's MaxInFlight) takes a fresh
+	// semaphore; requests holding the old one still release into it.
+	if !ok || cap(sem.slots) != limit {
+		sem = &localSemaphore{slots: make(chan struct{}, limit)}
+		s.sems[key] = sem
+	}
+	return sem
+}
+
+func (s *localSemaphores) acquire(ctx context.Context, key string, limit int) (func(), error) {
+	sem := s.get(key, limit)
+	release := func() { <-sem.slots }
+
+	select {
+	case sem.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	s.mu.Lock()
+	if sem.waiting >= s.cfg.QueueSize {
+		s.mu.Unlock()
+		return nil, errSaturated
+	}
+	sem.waiting++
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		sem.waiting--
+		s.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(s.cfg.QueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case sem.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, errSaturated
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,152 @@
+package concurrency
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Each slot is a member of the sorted set KEYS[1] scored by its lease expiry
+// (Redis TIME, ms). Expired members are dropped before counting, so slots of
+// a replica that died mid-request come back once their lease runs out.
+
+// acquireScript adds member ARGV[3] with lease ARGV[2] ms if fewer than
+// ARGV[1] unexpired members exist. Returns 1 when acquired.
+var acquireScript = redis.NewScript(`
+redis.replicate_commands()
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local lease = tonumber(ARGV[2])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[1]) then
+  return 0
+end
+redis.call('ZADD', KEYS[1], now + lease, ARGV[3])
+redis.call('PEXPIRE', KEYS[1], lease)
+return 1
+`)
+
+// renewScript extends the lease of member ARGV[2] if it is still held
+var renewScript = redis.NewScript(`
+redis.replicate_commands()
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local lease = tonumber(ARGV[1])
+
+if redis.call('ZSCORE', KEYS[1], ARGV[2]) then
+  redis.call('ZADD', KEYS[1], 'XX', now + lease, ARGV[2])
+  redis.call('PEXPIRE', KEYS[1], lease)
+  return 1
+end
+return 0
+`)
+
+// Polling bounds while queued for a distributed slot
+const (
+	minPoll = 10 * time.Millisecond
+	maxPoll = 200 * time.Millisecond
+)
+
+// redisSemaphores shares slots across replicas. The wait queue is local:
+// each replica lets up to QueueSize requests per key poll for a slot.
+type redisSemaphores struct {
+	redis *redis.Client
+	cfg   Config
+
+	mu      sync.Mutex
+	waiting map[string]int
+}
+
+func newRedisSemaphores(redis *redis.Client, cfg Config) *redisSemaphores {
+	return &redisSemaphores{redis: redis, cfg: cfg, waiting: make(map[string]int)}
+}
+
+func (s *redisSemaphores) tryAcquire(ctx context.Context, key string, limit int, member string) (bool, error) {
+	n, err := acquireScript.Run(ctx, s.redis, []string{key}, limit, s.cfg.Lease.Milliseconds(), member).Int()
+	return n == 1, err
+}
+
+func (s *redisSemaphores) acquire(ctx context.Context, key string, limit int) (func(), error) {
+	member := newMember()
+
+	ok, err := s.tryAcquire(ctx, key, limit, member)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if ok, err = s.wait(ctx, key, limit, member); err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errSaturated
+		}
+	}
+
+	// Keep the lease alive for as long as the request runs
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(s.cfg.Lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				renewScript.Run(context.Background(), s.redis, []string{key}, s.cfg.Lease.Milliseconds(), member)
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		s.redis.ZRem(context.Background(), key, member)
+	}, nil
+}
+
+// wait polls for a slot with backoff until QueueTimeout
+func (s *redisSemaphores) wait(ctx context.Context, key string, limit int, member string) (bool, error) {
+	s.mu.Lock()
+	if s.waiting[key] >= s.cfg.QueueSize {
+		s.mu.Unlock()
+		return false, nil
+	}
+	s.waiting[key]++
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		if s.waiting[key]--; s.waiting[key] == 0 {
+			delete(s.waiting, key)
+		}
+		s.mu.Unlock()
+	}()
+
+	deadline := time.Now().Add(s.cfg.QueueTimeout)
+	poll := minPoll
+	for time.Now().Before(deadline) {
+		select {
+		case <-time.After(min(poll, time.Until(deadline))):
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+
+		ok, err := s.tryAcquire(ctx, key, limit, member)
+		if err != nil || ok {
+			return ok, err
+		}
+		poll = min(poll*2, maxPoll)
+	}
+	return false, nil
+}
+
+// newMember is a unique sorted-set member for one slot
+func newMember() string {
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,466 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v2"
+
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/cache"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/coalesce"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/proxy"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/upstream"
+)
+
+// Handlers are the built-in handlers a route can serve instead of proxying
+var Handlers = []string{"analytics"}
+
+// Config is the declarative routing table: named upstreams and the routes
+// that forward to them.
+type Config struct {
+	Upstreams map[string]Upstream `json:"upstreams" yaml:"upstreams"`
+	Routes    []Route             `json:"routes" yaml:"routes"`
+}
+
+// Upstream is a backend service routes can forward to: a single url, or
+// targets balanced by the chosen strategy.
+type Upstream struct {
+	URL string `json:"url,omitempty" yaml:"url,omitempty"`
+
+	Targets []Target `json:"targets,omitempty" yaml:"targets,omitempty"`
+	Balance string   `json:"balance,omitempty" yaml:"balance,omitempty"` // default round_robin
+	HashOn  string   `json:"hash_on,omitempty" yaml:"hash_on,omitempty"` // consistent_hash: tenant or header:<Name>
+
+	HealthCheck *HealthCheck `json:"health_check,omitempty" yaml:"health_check,omitempty"`
+	Outlier     *Outlier     `json:"outlier,omitempty" yaml:"outlier,omitempty"`
+
+	// Timeouts override the UPSTREAM_*_TIMEOUT defaults
+	Timeouts *UpstreamTimeouts `json:"timeouts,omitempty" yaml:"timeouts,omitempty"`
+}
+
+// UpstreamTimeouts bound connecting to and waiting on an upstream
+type UpstreamTimeouts struct {
+	Dial           Duration `json:"dial,omitempty" yaml:"dial,omitempty"`
+	TLSHandshake   Duration `json:"tls_handshake,omitempty" yaml:"tls_handshake,omitempty"`
+	ResponseHeader Duration `json:"response_header,omitempty" yaml:"response_header,omitempty"`
+}
+
+// HealthCheck probes each target with GET path; unset fields take defaults
+// (interval 10s, timeout 2s, healthy_threshold 2, unhealthy_threshold 3)
+type HealthCheck struct {
+	Path               string   `json:"path" yaml:"path"`
+	Interval           Duration `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Timeout            Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	HealthyThreshold   int      `json:"healthy_threshold,omitempty" yaml:"healthy_threshold,omitempty"`
+	UnhealthyThreshold int      `json:"unhealthy_threshold,omitempty" yaml:"unhealthy_threshold,omitempty"`
+}
+
+// Outlier ejects a target after consecutive_failures 5xx or connection
+// errors in a row, for ejection_time (default 30s)
+type Outlier struct {
+	ConsecutiveFailures int      `json:"consecutive_failures" yaml:"consecutive_failures"`
+	EjectionTime        Duration `json:"ejection_time,omitempty" yaml:"ejection_time,omitempty"`
+}
+
+// Target is one instance of a balanced upstream
+type Target struct {
+	URL    string `json:"url" yaml:"url"`
+	Weight int    `json:"weight,omitempty" yaml:"weight,omitempty"`
+}
+
+// Spec is the upstream in the pool's terms
+func (u Upstream) Spec() upstream.Spec {
+	spec := upstream.Spec{Balance: u.Balance, HashOn: u.HashOn}
+	if u.URL != "" {
+		spec.Targets = append(spec.Targets, upstream.Target{URL: u.URL})
+	}
+	for _, t := range u.Targets {
+		spec.Targets = append(spec.Targets, upstream.Target{URL: t.URL, Weight: t.Weight})
+	}
+	if hc := u.HealthCheck; hc != nil {
+		spec.HealthCheck = upstream.HealthCheck{
+			Path:               hc.Path,
+			Interval:           time.Duration(hc.Interval),
+			Timeout:            time.Duration(hc.Timeout),
+			HealthyThreshold:   hc.HealthyThreshold,
+			UnhealthyThreshold: hc.UnhealthyThreshold,
+		}
+	}
+	if t := u.Timeouts; t != nil {
+		spec.Timeouts = upstream.Timeouts{
+			Dial:           time.Duration(t.Dial),
+			TLSHandshake:   time.Duration(t.TLSHandshake),
+			ResponseHeader: time.Duration(t.ResponseHeader),
+		}
+	}
+	if o := u.Outlier; o != nil {
+		spec.Outlier = upstream.Outlier{
+			ConsecutiveFailures: o.ConsecutiveFailures,
+			EjectionTime:        time.Duration(o.EjectionTime),
+		}
+	}
+	return spec
+}
+
+// Route maps requests to an upstream (or a built-in handler). Set either
+// prefix (segment-aware) or path (exact, with {param} and trailing *
+// segments). The most specific matching route wins, see proxy.Route.
+type Route struct {
+	Prefix string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	Path   string `json:"path,omitempty" yaml:"path,omitempty"`
+
+	Methods []string          `json:"methods,omitempty" yaml:"methods,omitempty"`
+	Host    string            `json:"host,omitempty" yaml:"host,omitempty"`
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Query   map[string]string `json:"query,omitempty" yaml:"query,omitempty"`
+
+	Upstream string `json:"upstream,omitempty" yaml:"upstream,omitempty"`
+	Handler  string `json:"handler,omitempty" yaml:"handler,omitempty"`
+
+	// Rewrite changes the path and Host sent to the upstream
+	Rewrite *Rewrite `json:"rewrite,omitempty" yaml:"rewrite,omitempty"`
+
+	// Retry replays failed attempts of idempotent requests
+	Retry *Retry `json:"retry,omitempty" yaml:"retry,omitempty"`
+
+	// Hedge races slow GET/HEAD requests against a second instance
+	Hedge *Hedge `json:"hedge,omitempty" yaml:"hedge,omitempty"`
+
+	Middleware `yaml:",inline"`
+
+	// Tenants overrides the middleware settings, or the upstream, for
+	// individual tenants on this route
+	Tenants map[string]Override `json:"tenants,omitempty" yaml:"tenants,omitempty"`
+}
+
+// Middleware selects the per-route middleware. Unset fields take defaults:
+// auth on, rate limiting on when auth is, chaos on, no timeout, no cache,
+// no coalescing.
+type Middleware struct {
+	Auth      *bool     `json:"auth,omitempty" yaml:"auth,omitempty"`             // require tenant credentials
+	RateLimit *bool     `json:"rate_limit,omitempty" yaml:"rate_limit,omitempty"` // rate limit, concurrency and quota
+	Chaos     *bool     `json:"chaos,omitempty" yaml:"chaos,omitempty"`           // eligible for chaos injection
+	Timeout   Duration  `json:"timeout,omitempty" yaml:"timeout,omitempty"`       // whole request, 0 = none
+	Cache     *Cache    `json:"cache,omitempty" yaml:"cache,omitempty"`           // cache GET responses per tenant
+	Coalesce  *Coalesce `json:"coalesce,omitempty" yaml:"coalesce,omitempty"`     // share one upstream call among identical GETs
+}
+
+// Pattern is the route's path pattern
+func (r Route) Pattern() string {
+	if r.Path != "" {
+		return r.Path
+	}
+	return r.Prefix
+}
+
+// Match is the route's matching rules in the router's terms
+func (r Route) Match(handler http.Handler) proxy.Route {
+	return proxy.Route{
+		Prefix:  r.Prefix,
+		Path:    r.Path,
+		Methods: r.Methods,
+		Host:    r.Host,
+		Headers: r.Headers,
+		Query:   r.Query,
+		Handler: handler,
+	}
+}
+
+// Rewrite maps the public path onto the upstream's. Steps run in order:
+// strip_prefix, regex/replacement, add_prefix.
+type Rewrite struct {
+	StripPrefix string `json:"strip_prefix,omitempty" yaml:"strip_prefix,omitempty"`
+	AddPrefix   string `json:"add_prefix,omitempty" yaml:"add_prefix,omitempty"`
+	Regex       string `json:"regex,omitempty" yaml:"regex,omitempty"`
+	Replacement string `json:"replacement,omitempty" yaml:"replacement,omitempty"` // $1, ${name}
+	Host        string `json:"host,omitempty" yaml:"host,omitempty"`               // Host header override
+}
+
+// Compile returns the rewrite in the proxy's terms; nil is no rewrite
+func (rw *Rewrite) Compile() (proxy.Rewrite, error) {
+	if rw == nil {
+		return proxy.Rewrite{}, nil
+	}
+	return proxy.NewRewrite(rw.StripPrefix, rw.AddPrefix, rw.Regex, rw.Replacement, rw.Host)
+}
+
+// Retry is a route's retry policy. Only GET, HEAD, OPTIONS, TRACE, PUT and
+// DELETE are retried, or other methods carrying an Idempotency-Key.
+type Retry struct {
+	Attempts      int      `json:"attempts" yaml:"attempts"`                                 // including the first
+	On            []string `json:"on,omitempty" yaml:"on,omitempty"`                         // default connect_error, 502, 503, 504
+	Backoff       Duration `json:"backoff,omitempty" yaml:"backoff,omitempty"`               // default 25ms, doubling
+	MaxBackoff    Duration `json:"max_backoff,omitempty" yaml:"max_backoff,omitempty"`       // default 250ms
+	BudgetPercent float64  `json:"budget_percent,omitempty" yaml:"budget_percent,omitempty"` // default 20
+	MinRetries    int      `json:"min_retries,omitempty" yaml:"min_retries,omitempty"`       // per 10s, default 3
+}
+
+// Policy is the retry in the upstream package's terms
+func (r Retry) Policy() upstream.RetryPolicy {
+	return upstream.RetryPolicy{
+		Attempts:      r.Attempts,
+		On:            r.On,
+		Backoff:       time.Duration(r.Backoff),
+		MaxBackoff:    time.Duration(r.MaxBackoff),
+		BudgetPercent: r.BudgetPercent,
+		MinRetries:    r.MinRetries,
+	}
+}
+
+// Hedge sends a second GET or HEAD to another instance once the first has
+// not answered within delay, or within the path's latency percentile when
+// set (delay then applies until there is latency data)
+type Hedge struct {
+	Delay      Duration `json:"delay,omitempty" yaml:"delay,omitempty"`
+	Percentile string   `json:"percentile,omitempty" yaml:"percentile,omitempty"` // p50, p95, p99
+}
+
+// Policy is the hedge in the upstream package's terms
+func (h Hedge) Policy() upstream.HedgePolicy {
+	return upstream.HedgePolicy{Delay: time.Duration(h.Delay), Percentile: h.Percentile}
+}
+
+// Cache stores a route's GET responses per tenant as the upstream's
+// Cache-Control, Expires and Vary allow. ttl replaces the upstream's
+// freshness lifetime, stale_while_revalidate its stale window.
+type Cache struct {
+	TTL                  Duration `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	StaleWhileRevalidate Duration `json:"stale_while_revalidate,omitempty" yaml:"stale_while_revalidate,omitempty"`
+}
+
+// Policy is the cache in the cache package's terms
+func (c Cache) Policy() cache.Policy {
+	return cache.Policy{TTL: time.Duration(c.TTL), StaleWhileRevalidate: time.Duration(c.StaleWhileRevalidate)}
+}
+
+// Coalesce collapses concurrent identical GET and HEAD requests into one
+// upstream call. Requests are identical when tenant, method, host, path,
+// query and the listed headers match.
+type Coalesce struct {
+	Headers []string `json:"headers,omitempty" yaml:"headers,omitempty"`
+}
+
+// Policy is the coalescing in the coalesce package's terms
+func (c Coalesce) Policy() coalesce.Policy {
+	return coalesce.Policy{Headers: c.Headers}
+}
+
+// Override replaces route settings for one tenant
+type Override struct {
+	Upstream string `json:"upstream,omitempty" yaml:"upstream,omitempty"`
+
+	RateLimit *bool    `json:"rate_limit,omitempty" yaml:"rate_limit,omitempty"`
+	Chaos     *bool    `json:"chaos,omitempty" yaml:"chaos,omitempty"`
+	Timeout   Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// AuthEnabled reports whether the route requires a tenant
+func (m Middleware) AuthEnabled() bool {
+	return m.Auth == nil || *m.Auth
+}
+
+// RateLimitEnabled reports whether tenant limits apply; they need a tenant
+func (m Middleware) RateLimitEnabled() bool {
+	if m.RateLimit == nil {
+		return m.AuthEnabled()
+	}
+	return *m.RateLimit
+}
+
+// ChaosEnabled reports whether chaos injection may affect the route
+func (m Middleware) ChaosEnabled() bool {
+	return m.Chaos == nil || *m.Chaos
+}
+
+// Apply returns the route's middleware with o's settings laid over it
+func (o Override) Apply(m Middleware) Middleware {
+	if o.RateLimit != nil {
+		m.RateLimit = o.RateLimit
+	}
+	if o.Chaos != nil {
+		m.Chaos = o.Chaos
+	}
+	if o.Timeout > 0 {
+		m.Timeout = o.Timeout
+	}
+	return m
+}
+
+// Duration is a time.Duration written as "500ms", "10s" etc.
+type Duration time.Duration
+
+func (d *Duration) parse(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"10s\": %w", err)
+	}
+	return d.parse(s)
+}
+
+func (d *Duration) UnmarshalYAML(unmarshal func(any) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d Duration) MarshalYAML() (any, error) {
+	return time.Duration(d).String(), nil
+}
+
+// Load reads a YAML or JSON config file (by extension) and validates it
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&cfg)
+	} else {
+		err = yaml.UnmarshalStrict(data, &cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate reports every problem in the config at once
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.Upstreams)) {
+		u := c.Upstreams[name]
+		if (u.URL == "") == (len(u.Targets) == 0) {
+			fail("upstream %q: set either url or targets", name)
+			continue
+		}
+		if err := u.Spec().Validate(); err != nil {
+			fail("upstream %q: %v", name, err)
+		}
+		if u.HealthCheck != nil && u.HealthCheck.Path == "" {
+			fail("upstream %q: health_check needs a path", name)
+		}
+		if u.Outlier != nil && u.Outlier.ConsecutiveFailures <= 0 {
+			fail("upstream %q: outlier needs consecutive_failures", name)
+		}
+	}
+
+	if len(c.Routes) == 0 {
+		fail("no routes defined")
+	}
+	// A dry run through the router catches bad patterns and ambiguity
+	router := proxy.NewRouter()
+	for i, r := range c.Routes {
+		where := fmt.Sprintf("route %d (%s)", i+1, r.Pattern())
+
+		if err := router.Add(r.Match(http.NotFoundHandler())); err != nil {
+			fail("%s: %v", where, err)
+		}
+
+		switch {
+		case r.Upstream != "" && r.Handler != "":
+			fail("%s: set either upstream or handler, not both", where)
+		case r.Upstream != "":
+			if _, ok := c.Upstreams[r.Upstream]; !ok {
+				fail("%s: unknown upstream %q", where, r.Upstream)
+			}
+		case r.Handler != "":
+			if !slices.Contains(Handlers, r.Handler) {
+				fail("%s: unknown handler %q (known: %s)", where, r.Handler, strings.Join(Handlers, ", "))
+			}
+		default:
+			fail("%s: upstream or handler is required", where)
+		}
+
+		if r.Rewrite != nil {
+			if r.Handler != "" {
+				fail("%s: rewrite only applies to upstream routes", where)
+			} else if _, err := r.Rewrite.Compile(); err != nil {
+				fail("%s: rewrite: %v", where, err)
+			}
+		}
+		if r.Retry != nil {
+			if r.Handler != "" {
+				fail("%s: retry only applies to upstream routes", where)
+			} else if err := r.Retry.Policy().Validate(); err != nil {
+				fail("%s: retry: %v", where, err)
+			}
+		}
+		if r.Hedge != nil {
+			if r.Handler != "" {
+				fail("%s: hedge only applies to upstream routes", where)
+			} else if err := r.Hedge.Policy().Validate(); err != nil {
+				fail("%s: hedge: %v", where, err)
+			}
+		}
+		if r.Timeout < 0 {
+			fail("%s: timeout must not be negative", where)
+		}
+		if r.Cache != nil && (r.Cache.TTL < 0 || r.Cache.StaleWhileRevalidate < 0) {
+			fail("%s: cache durations must not be negative", where)
+		}
+		if r.Coalesce != nil && slices.Contains(r.Coalesce.Headers, "") {
+			fail("%s: coalesce: empty header name", where)
+		}
+		if !r.AuthEnabled() && r.RateLimit != nil && *r.RateLimit {
+			fail("%s: rate_limit needs auth", where)
+		}
+		if !r.AuthEnabled() && r.Cache != nil {
+			fail("%s: cache needs auth", where)
+		}
+
+		for _, id := range slices.Sorted(maps.Keys(r.Tenants)) {
+			o := r.Tenants[id]
+			if !r.AuthEnabled() {
+				fail("%s: tenant overrides need auth", where)
+				break
+			}
+			if o.Upstream != "" {
+				if r.Handler != "" {
+					fail("%s: tenant %q: upstream override on a handler route", where, id)
+				} else if _, ok := c.Upstreams[o.Upstream]; !ok {
+					fail("%s: tenant %q: unknown upstream %q", where, id, o.Upstream)
+				}
+			}
+			if o.Timeout < 0 {
+				fail("%s: tenant %q: timeout must not be negative", where, id)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
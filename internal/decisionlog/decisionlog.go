@@ -11,10 +11,13 @@ import (
 type DecisionType string
 
 const (
-	DecisionAllow DecisionType = "ALLOW"
-	DecisionBlock DecisionType = "BLOCK"
-	DecisionRoute DecisionType = "ROUTE"
-	DecisionChaos DecisionType = "CHAOS"
+	DecisionAllow  DecisionType = "ALLOW"
+	DecisionBlock  DecisionType = "BLOCK"
+	DecisionRoute  DecisionType = "ROUTE"
+	DecisionChaos  DecisionType = "CHAOS"
+	DecisionTenant DecisionType = "TENANT"
+	DecisionConfig DecisionType = "CONFIG"
+	DecisionHealth DecisionType = "HEALTH"
 )
 
 // DecisionLog represents a structured log for intelligent decisions
@@ -0,0 +1,214 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/adaptive"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/analytics"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/cache"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/chaos"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/circuit"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/coalesce"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/concurrency"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/config"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/proxy"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/quota"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/ratelimit"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/tenant"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/upstream"
+)
+
+// Deps are the shared components every route's chain is assembled from
+type Deps struct {
+	Analytics   *analytics.Analytics
+	RateLimiter *ratelimit.RateLimiter
+	Concurrency *concurrency.Limiter
+	Quotas      *quota.Enforcer
+	Shedder     *adaptive.Limiter
+	Upstreams   *upstream.Registry
+	Breakers    *circuit.Breakers
+	Cache       *cache.Cache
+
+	// Handlers serves routes that name a built-in handler
+	Handlers map[string]http.Handler
+}
+
+// Build turns the config into a router. Each route gets its own chain (from
+// outer to inner):
+//
+//  1. Auth          - 401 without tenant credentials (auth)
+//  2. Timeout       - bounds the whole request (timeout)
+//  3. Analytics     - records all requests, even if blocked later
+//  4. Chaos         - simulated latency/errors (chaos)
+//  5. Rate Limiter  - plan and rule limits (rate_limit)
+//  6. Concurrency   - in-flight caps per tenant and backend (rate_limit)
+//  7. Quota         - daily/monthly billing quotas (rate_limit)
+//  8. Cache         - serves stored GET responses per tenant (cache)
+//  9. Coalesce      - shares one upstream call among identical GETs (coalesce)
+//  10. Adaptive     - sheds load when the backend degrades
+//  11. Circuit      - fails fast while the upstream is failing
+//  12. Upstream     - reverse proxy or built-in handler
+//
+// Tenants with an override get a chain of their own. The upstream pools are
+// only prepared: the caller commits the returned update once the router is
+// being served, or aborts it.
+func Build(cfg *config.Config, deps Deps) (*proxy.Router, *upstream.Update, error) {
+	registry := deps.Upstreams
+	if registry == nil {
+		registry = upstream.NewRegistry(upstream.DefaultTimeouts)
+	}
+	specs := make(map[string]upstream.Spec, len(cfg.Upstreams))
+	for name, u := range cfg.Upstreams {
+		specs[name] = u.Spec()
+	}
+	update, err := registry.Prepare(specs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	router := proxy.NewRouter()
+	for _, route := range cfg.Routes {
+		h, err := buildRoute(route, update.Pools(), deps)
+		if err != nil {
+			update.Abort()
+			return nil, nil, fmt.Errorf("route %s: %w", route.Pattern(), err)
+		}
+		if err := router.Add(route.Match(h)); err != nil {
+			update.Abort()
+			return nil, nil, err
+		}
+	}
+	return router, update, nil
+}
+
+func buildRoute(route config.Route, pools map[string]*upstream.Pool, deps Deps) (http.Handler, error) {
+	rewrite, err := route.Rewrite.Compile()
+	if err != nil {
+		return nil, fmt.Errorf("rewrite: %w", err)
+	}
+	// Each route gets its own proxies so the Director carries its rewrite
+	// and retries keep a budget per route
+	forward := func(name string) (http.Handler, error) {
+		pool, ok := pools[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown upstream %q", name)
+		}
+		// Retries wrap hedging, so each retry may be hedged in turn
+		var up upstream.Transport = pool
+		if route.Hedge != nil {
+			up = upstream.NewHedger(pool, route.Hedge.Policy())
+		}
+		if route.Retry != nil {
+			up = upstream.NewRetrier(up, route.Retry.Policy())
+		}
+		h := proxy.ProxyHandler(up, rewrite)
+		if deps.Breakers != nil {
+			h = deps.Breakers.Middleware(name, h)
+		}
+		return h, nil
+	}
+
+	var target http.Handler
+	switch {
+	case route.Handler != "":
+		target = deps.Handlers[route.Handler]
+	case route.Upstream != "":
+		if target, err = forward(route.Upstream); err != nil {
+			return nil, err
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("nothing to serve: upstream %q, handler %q", route.Upstream, route.Handler)
+	}
+
+	def := chain(route.Middleware, target, deps)
+	if len(route.Tenants) == 0 {
+		return def, nil
+	}
+
+	overrides := make(map[string]http.Handler, len(route.Tenants))
+	for id, o := range route.Tenants {
+		t := target
+		if o.Upstream != "" {
+			if t, err = forward(o.Upstream); err != nil {
+				return nil, fmt.Errorf("tenant %q: %w", id, err)
+			}
+		}
+		overrides[id] = chain(o.Apply(route.Middleware), t, deps)
+	}
+
+	// Overrides need auth, so the tenant is known once it has run; resolve
+	// here to pick the chain and let that chain enforce it.
+	return tenant.ResolutionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t, ok := tenant.FromContext(r.Context()); ok {
+			if h, ok := overrides[t.ID]; ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+		def.ServeHTTP(w, r)
+	})), nil
+}
+
+func chain(m config.Middleware, target http.Handler, deps Deps) http.Handler {
+	h := target
+	if deps.Shedder != nil {
+		h = deps.Shedder.Middleware(h)
+	}
+	if m.Coalesce != nil {
+		h = coalesce.Middleware(m.Coalesce.Policy(), h)
+	}
+	if m.Cache != nil && deps.Cache != nil {
+		h = deps.Cache.Middleware(m.Cache.Policy(), h)
+	}
+	if m.RateLimitEnabled() {
+		if deps.Quotas != nil {
+			h = deps.Quotas.Middleware(h)
+		}
+		if deps.Concurrency != nil {
+			h = deps.Concurrency.Middleware(h)
+		}
+		if deps.RateLimiter != nil {
+			h = deps.RateLimiter.Middleware(h)
+		}
+	}
+	if m.ChaosEnabled() {
+		h = chaos.Middleware(h)
+	}
+	if deps.Analytics != nil {
+		h = analytics.Middleware(deps.Analytics, h)
+	}
+	if m.Timeout > 0 {
+		h = withTimeout(h, time.Duration(m.Timeout))
+	}
+	if m.AuthEnabled() {
+		h = requireTenant(h)
+	}
+	return h
+}
+
+// requireTenant rejects requests whose tenant was not resolved further out,
+// with the same reasons tenant.Middleware gives.
+func requireTenant(next http.Handler) http.Handler {
+	authenticate := tenant.Middleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := tenant.FromContext(r.Context()); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		authenticate.ServeHTTP(w, r)
+	})
+}
+
+// withTimeout cancels the request context after d; the proxy then answers
+// 504 Gateway Timeout.
+func withTimeout(next http.Handler, d time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,238 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/config"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/decisionlog"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/upstream"
+)
+
+// ErrNoConfigFile is returned by Reload when the gateway runs on built-in
+// routes rather than a config file
+var ErrNoConfigFile = errors.New("no config file to reload (GATEWAY_CONFIG not set)")
+
+// Status describes the routing table currently being served
+type Status struct {
+	Version  int            `json:"version"`
+	Hash     string         `json:"hash"`
+	Path     string         `json:"path,omitempty"`
+	LoadedAt time.Time      `json:"loaded_at"`
+	Config   *config.Config `json:"config"`
+}
+
+// generation is one built routing table; it is never modified after Build
+type generation struct {
+	status  Status
+	handler http.Handler
+
+	upstreams *upstream.Update // committed when the generation is installed
+}
+
+// Live serves the most recent generation of the routing table. A reload
+// builds a complete new router and swaps it in atomically: a request keeps
+// the router it started on, so in-flight requests finish on the old chains
+// and connections are never dropped.
+type Live struct {
+	path string
+	deps Deps
+
+	current atomic.Pointer[generation]
+	modTime atomic.Int64
+
+	mu    sync.Mutex // serializes reloads
+	hooks []ReloadHook
+}
+
+// ReloadHook prepares a policy reload (e.g. rate limit rules) from the new
+// config without changing anything yet. The returned apply puts it in place
+// and only runs once every hook and the new routes are ready.
+type ReloadHook func(cfg *config.Config) (apply func(), err error)
+
+// NewLive builds the first generation from cfg. path is the file Reload
+// reads; it may be empty when cfg is built in.
+func NewLive(path string, cfg *config.Config, deps Deps) (*Live, error) {
+	l := &Live{path: path, deps: deps}
+	if path != "" {
+		if info, err := os.Stat(path); err == nil {
+			l.modTime.Store(info.ModTime().UnixNano())
+		}
+	}
+
+	g, err := l.build(cfg, 1)
+	if err != nil {
+		return nil, err
+	}
+	l.current.Store(g)
+	g.upstreams.Commit()
+	return l, nil
+}
+
+// OnReload registers a policy reload that runs with every config reload. A
+// hook that fails to prepare aborts the reload; nothing is applied and the
+// current routing table stays in place.
+func (l *Live) OnReload(hook ReloadHook) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, hook)
+}
+
+func (l *Live) build(cfg *config.Config, version int) (*generation, error) {
+	router, upstreams, err := Build(cfg, l.deps)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		upstreams.Abort()
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+
+	return &generation{
+		status: Status{
+			Version:  version,
+			Hash:     hex.EncodeToString(sum[:])[:16],
+			Path:     l.path,
+			LoadedAt: time.Now(),
+			Config:   cfg,
+		},
+		handler:   router,
+		upstreams: upstreams,
+	}, nil
+}
+
+func (l *Live) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.current.Load().handler.ServeHTTP(w, r)
+}
+
+// Status reports the generation currently being served
+func (l *Live) Status() Status {
+	return l.current.Load().status
+}
+
+// Reload re-reads the config file and swaps in the new routing table. An
+// invalid file leaves the current one in place.
+func (l *Live) Reload() (Status, error) {
+	if l.path == "" {
+		return l.Status(), ErrNoConfigFile
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if info, err := os.Stat(l.path); err == nil {
+		l.modTime.Store(info.ModTime().UnixNano())
+	}
+
+	cfg, err := config.Load(l.path)
+	if err != nil {
+		return l.Status(), err
+	}
+	old := l.current.Load()
+	g, err := l.build(cfg, old.status.Version+1)
+	if err != nil {
+		return old.status, err
+	}
+	applies := make([]func(), 0, len(l.hooks))
+	for _, hook := range l.hooks {
+		apply, err := hook(cfg)
+		if err != nil {
+			g.upstreams.Abort()
+			return old.status, fmt.Errorf("policy reload: %w", err)
+		}
+		if apply != nil {
+			applies = append(applies, apply)
+		}
+	}
+
+	l.current.Store(g)
+	g.upstreams.Commit()
+	for _, apply := range applies {
+		apply()
+	}
+	log.Printf("[CONFIG] reloaded %s: version %d, hash %s, %d routes",
+		l.path, g.status.Version, g.status.Hash, len(cfg.Routes))
+	return g.status, nil
+}
+
+// Watch polls the config file and reloads it when its modification time
+// changes
+func (l *Live) Watch(interval time.Duration) {
+	if l.path == "" {
+		return
+	}
+	go func() {
+		for {
+			time.Sleep(interval)
+
+			info, err := os.Stat(l.path)
+			if err != nil || info.ModTime().UnixNano() == l.modTime.Load() {
+				continue
+			}
+
+			if _, err := l.Reload(); err != nil {
+				log.Printf("[CONFIG] reload of %s failed, keeping current routes: %v", l.path, err)
+			}
+		}
+	}()
+}
+
+// StatusHandler handles GET /admin/config
+func StatusHandler(l *Live) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(l.Status())
+	}
+}
+
+// ReloadHandler handles POST /admin/config/reload
+func ReloadHandler(l *Live) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		previous := l.Status().Version
+		status, err := l.Reload()
+		if err != nil {
+			decisionlog.LogDecision(r, decisionlog.DecisionConfig, "Config reload rejected", map[string]any{
+				"version": status.Version,
+				"error":   err.Error(),
+			})
+			code := http.StatusUnprocessableEntity
+			if errors.Is(err, ErrNoConfigFile) {
+				code = http.StatusConflict
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+
+		decisionlog.LogDecision(r, decisionlog.DecisionConfig, "Config reloaded", map[string]any{
+			"previous_version": previous,
+			"version":          status.Version,
+			"hash":             status.Hash,
+		})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"version":   status.Version,
+			"hash":      status.Hash,
+			"loaded_at": status.LoadedAt,
+		})
+	}
+}
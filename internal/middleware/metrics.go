@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"strconv"
@@ -54,6 +55,14 @@ var (
 		},
 		[]string{"tenant"},
 	)
+
+	coalescedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_gateway_coalesced_requests_total",
+			Help: "Total number of coalescing requests by route and outcome (upstream: made the call, shared: got another request's response)",
+		},
+		[]string{"route", "outcome"},
+	)
 )
 
 // MetricsCollector holds in-memory metrics (for /admin/metrics JSON endpoint)
@@ -68,6 +77,13 @@ type MetricsCollector struct {
 
 	// Histograms (simplified: track P50, P95, P99)
 	latencies map[string][]time.Duration // route:tenant -> durations
+
+	// Request coalescing per route
+	coalesced map[string]*coalesceCount
+}
+
+type coalesceCount struct {
+	requests, upstreamCalls int64
 }
 
 var metricsCollector = &MetricsCollector{
@@ -76,6 +92,7 @@ var metricsCollector = &MetricsCollector{
 	droppedCount:   make(map[string]int64),
 	rateLimitCount: make(map[string]int64),
 	latencies:      make(map[string][]time.Duration),
+	coalesced:      make(map[string]*coalesceCount),
 }
 
 // RecordRequest records a request with labels
@@ -141,6 +158,30 @@ func RecordRateLimit(tenant string) {
 	metricsCollector.rateLimitCount[tenant]++
 }
 
+// RecordCoalesce records a request on a coalescing route; shared means it
+// got another request's response instead of calling the upstream
+func RecordCoalesce(route string, shared bool) {
+	outcome := "upstream"
+	if shared {
+		outcome = "shared"
+	}
+	// Record to Prometheus
+	coalescedTotal.WithLabelValues(route, outcome).Inc()
+
+	// Record to in-memory collector (for JSON API)
+	metricsCollector.mu.Lock()
+	defer metricsCollector.mu.Unlock()
+	c, ok := metricsCollector.coalesced[route]
+	if !ok {
+		c = &coalesceCount{}
+		metricsCollector.coalesced[route] = c
+	}
+	c.requests++
+	if !shared {
+		c.upstreamCalls++
+	}
+}
+
 // GetMetrics returns current metrics for Grafana JSON scraping
 func GetMetrics() map[string]interface{} {
 	metricsCollector.mu.RLock()
@@ -161,12 +202,27 @@ func GetMetrics() map[string]interface{} {
 		}
 	}
 
+	// Collapse ratio is requests per upstream call; 1 means nothing shared
+	coalescing := make(map[string]map[string]any, len(metricsCollector.coalesced))
+	for route, c := range metricsCollector.coalesced {
+		ratio := 1.0
+		if c.upstreamCalls > 0 {
+			ratio = float64(c.requests) / float64(c.upstreamCalls)
+		}
+		coalescing[route] = map[string]any{
+			"requests":       c.requests,
+			"upstream_calls": c.upstreamCalls,
+			"collapse_ratio": ratio,
+		}
+	}
+
 	return map[string]interface{}{
 		"requests_total":      metricsCollector.requestCount,
 		"errors_total":        metricsCollector.errorCount,
 		"requests_dropped":    metricsCollector.droppedCount,
 		"rate_limit_blocks":   metricsCollector.rateLimitCount,
 		"latency_percentiles": percentiles,
+		"coalescing":          coalescing,
 	}
 }
 
@@ -193,6 +249,38 @@ func calculatePercentiles(durations []time.Duration) (float64, float64, float64)
 	return p50, p95, p99
 }
 
+// Observer receives the outcome of every request forwarded to a backend
+type Observer func(backend string, status int, duration time.Duration)
+
+var (
+	observersMu sync.RWMutex
+	observers   []Observer
+)
+
+// AddObserver registers o to be called by Metrics after each request that
+// an inner handler marked with a backend (see Observation).
+func AddObserver(o Observer) {
+	observersMu.Lock()
+	defer observersMu.Unlock()
+	observers = append(observers, o)
+}
+
+type observationKey struct{}
+
+// Observation is attached to the request context by Metrics; an inner
+// handler that forwards the request sets Backend so observers see it.
+// Requests answered by the gateway itself (throttled, shed) leave it empty.
+type Observation struct {
+	Backend string
+}
+
+// ObservationFromContext returns the request's Observation, if Metrics is
+// in the chain.
+func ObservationFromContext(ctx context.Context) (*Observation, bool) {
+	obs, ok := ctx.Value(observationKey{}).(*Observation)
+	return obs, ok
+}
+
 // ResponseWriter wrapper to capture status code
 type statusCapture struct {
 	http.ResponseWriter
@@ -208,6 +296,8 @@ func Metrics(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		sc := &statusCapture{ResponseWriter: w, statusCode: http.StatusOK}
+		obs := &Observation{}
+		r = r.WithContext(context.WithValue(r.Context(), observationKey{}, obs))
 
 		next.ServeHTTP(sc, r)
 
@@ -232,5 +322,13 @@ func Metrics(next http.Handler) http.Handler {
 		log.Printf("[METRIC] path=%s tenant=%s status=%d duration_ms=%d",
 			route, tenantID, sc.statusCode, duration.Milliseconds())
 
+		if obs.Backend != "" {
+			observersMu.RLock()
+			for _, o := range observers {
+				o(obs.Backend, sc.statusCode, duration)
+			}
+			observersMu.RUnlock()
+		}
+
 	})
 }
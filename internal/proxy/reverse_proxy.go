@@ -1,28 +1,68 @@
 package proxy
 
 import (
+    "context"
+    "errors"
+    "net"
     "net/http"
     "net/http/httputil"
-    "net/url"
+
+    "github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/decisionlog"
+    "github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/upstream"
 )
 
-func NewReverseProxy(target string) (*httputil.ReverseProxy, error) {
-    backendURL, err := url.Parse(target)
-    if err != nil {
-        return nil, err
+// NewReverseProxy forwards to pool, applying rw inside the Director. The
+// Director only addresses the request to the pool; the pool's RoundTrip
+// picks the instance.
+func NewReverseProxy(pool upstream.Transport, rw Rewrite) *httputil.ReverseProxy {
+    return &httputil.ReverseProxy{
+        Director: func(req *http.Request) {
+            rw.apply(req)
+            req.URL.Scheme = "http"
+            req.URL.Host = pool.Name()
+            if _, ok := req.Header["User-Agent"]; !ok {
+                // explicitly disable User-Agent so it's not set to default value
+                req.Header.Set("User-Agent", "")
+            }
+        },
+        Transport:    pool,
+        ErrorHandler: errorHandler(pool.Name()),
     }
-    return httputil.NewSingleHostReverseProxy(backendURL), nil
 }
 
-func ProxyHandler(target string) (http.Handler, error) {
-    proxy, err := NewReverseProxy(target)
-    if err != nil {
-        return nil, err
+// errorHandler answers 504 when the request's deadline (route timeout) ran
+// out or a dial/TLS/response header timeout hit, 503 when the pool had no
+// instance and 502 for any other upstream failure.
+func errorHandler(target string) func(http.ResponseWriter, *http.Request, error) {
+    return func(w http.ResponseWriter, r *http.Request, err error) {
+        status := http.StatusBadGateway
+        reason := "Upstream request failed"
+        var netErr net.Error
+        switch {
+        case errors.Is(r.Context().Err(), context.DeadlineExceeded):
+            status = http.StatusGatewayTimeout
+            reason = "Request deadline exceeded"
+        case errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout():
+            status = http.StatusGatewayTimeout
+            reason = "Upstream timed out"
+        case errors.Is(err, upstream.ErrNoInstance):
+            status = http.StatusServiceUnavailable
+            reason = "No upstream instance available"
+        }
+
+        decisionlog.LogDecision(r, decisionlog.DecisionBlock, reason, map[string]any{
+            "target": target,
+            "error":  err.Error(),
+        })
+        w.WriteHeader(status)
     }
+}
+
+func ProxyHandler(pool upstream.Transport, rw Rewrite) http.Handler {
+    proxy := NewReverseProxy(pool, rw)
 
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        r = r.WithContext(r.Context())
+        r = r.WithContext(upstream.WithOriginalPath(r.Context(), r.URL.Path))
         proxy.ServeHTTP(w, r)
-    }), nil
+    })
 }
-
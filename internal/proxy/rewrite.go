@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Rewrite changes the request before it is forwarded upstream. The steps run
+// in order: StripPrefix, then Regex, then AddPrefix; the result is joined
+// onto the upstream URL's own path.
+//
+//	route /api/v1/users, StripPrefix "/api/v1"       /api/v1/users/7 -> /users/7
+//	Regex "^/u/(\d+)$", Replacement "/users/$1"      /u/7            -> /users/7
+type Rewrite struct {
+	StripPrefix string
+	AddPrefix   string
+
+	Regex       *regexp.Regexp
+	Replacement string // may refer to capture groups as $1 or ${name}
+
+	// Host replaces the Host header; empty keeps the client's
+	Host string
+}
+
+// NewRewrite compiles pattern (empty = no regex rewrite) into a Rewrite
+func NewRewrite(stripPrefix, addPrefix, pattern, replacement, host string) (Rewrite, error) {
+	rw := Rewrite{
+		StripPrefix: strings.TrimSuffix(stripPrefix, "/"),
+		AddPrefix:   strings.TrimSuffix(addPrefix, "/"),
+		Replacement: replacement,
+		Host:        host,
+	}
+	if stripPrefix != "" && !strings.HasPrefix(stripPrefix, "/") {
+		return rw, fmt.Errorf("strip_prefix %q must start with /", stripPrefix)
+	}
+	if addPrefix != "" && !strings.HasPrefix(addPrefix, "/") {
+		return rw, fmt.Errorf("add_prefix %q must start with /", addPrefix)
+	}
+	if strings.ContainsAny(host, "/ ") {
+		return rw, fmt.Errorf("host %q must be a bare host[:port]", host)
+	}
+	if pattern == "" {
+		if replacement != "" {
+			return rw, fmt.Errorf("replacement needs a regex")
+		}
+		return rw, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return rw, fmt.Errorf("regex %q: %w", pattern, err)
+	}
+	rw.Regex = re
+	return rw, nil
+}
+
+// IsZero reports whether the rewrite leaves requests untouched
+func (rw Rewrite) IsZero() bool {
+	return rw.StripPrefix == "" && rw.AddPrefix == "" && rw.Regex == nil && rw.Host == ""
+}
+
+// Path applies the path steps to p
+func (rw Rewrite) Path(p string) string {
+	if rw.StripPrefix != "" {
+		// Segment-aware, like prefix routes: /api does not strip /apis
+		if rest, ok := strings.CutPrefix(p, rw.StripPrefix); ok && (rest == "" || rest[0] == '/') {
+			p = rest
+		}
+		if p == "" {
+			p = "/"
+		}
+	}
+	if rw.Regex != nil {
+		p = rw.Regex.ReplaceAllString(p, rw.Replacement)
+	}
+	if rw.AddPrefix != "" {
+		if p == "/" {
+			p = rw.AddPrefix
+		} else {
+			p = rw.AddPrefix + p
+		}
+	}
+	return p
+}
+
+// apply rewrites req in place; it runs in the Director ahead of the upstream
+// URL being joined on
+func (rw Rewrite) apply(req *http.Request) {
+	if rw.StripPrefix != "" || rw.Regex != nil || rw.AddPrefix != "" {
+		req.URL.Path = rw.Path(req.URL.Path)
+		req.URL.RawPath = ""
+	}
+	if rw.Host != "" {
+		req.Host = rw.Host
+	}
+}
@@ -1,40 +1,378 @@
 package proxy
 
 import (
-    "net/http"
-    "strings"
-    "github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/decisionlog"
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/decisionlog"
 )
 
+type routeKey struct{}
+
+// RouteFromContext returns the pattern of the route that matched the request
+func RouteFromContext(ctx context.Context) (string, bool) {
+	prefix, ok := ctx.Value(routeKey{}).(string)
+	return prefix, ok
+}
+
+// Route matches requests by path and optional predicates. Set exactly one
+// of Prefix and Path:
+//
+//	Prefix "/users"       /users and everything below it, not /usersettings
+//	Path   "/users/{id}"  exactly one segment after /users, as r.PathValue("id")
+//	Path   "/files/*"     one or more segments after /files
+//
+// When several routes match, the most specific wins: segment by segment a
+// literal beats a {param}, which beats *; then the longer pattern; then
+// Path over Prefix; then the route with more predicates.
 type Route struct {
-    Prefix  string
-    Handler http.Handler
+	Prefix string
+	Path   string
+
+	Methods []string          // empty = any
+	Host    string            // "api.example.com" or "*.example.com"; empty = any
+	Headers map[string]string // header must equal value; "*" = present
+	Query   map[string]string // query parameter must equal value; "*" = present
+
+	Handler http.Handler
+}
+
+// Pattern is the route's path pattern as reported by RouteFromContext
+func (r Route) Pattern() string {
+	if r.Path != "" {
+		return r.Path
+	}
+	return r.Prefix
+}
+
+// Segment kinds, ordered by specificity
+const (
+	segWildcard = iota + 1
+	segParam
+	segStatic
+)
+
+type entry struct {
+	route  Route
+	exact  bool  // Path route: must consume the whole request path
+	kinds  []int // kind of each pattern segment
+	params []string
+}
+
+// node is one path segment in the trie
+type node struct {
+	static   map[string]*node
+	param    *node
+	wildcard []*entry // routes ending in /*
+	prefix   []*entry // Prefix routes ending here
+	exact    []*entry // Path routes ending here
+}
+
+func newNode() *node {
+	return &node{static: make(map[string]*node)}
 }
 
 type Router struct {
-    routes []Route
+	root    *node
+	entries []*entry
 }
 
 func NewRouter() *Router {
-    return &Router{}
+	return &Router{root: newNode()}
 }
 
+// AddRoute registers a prefix route; kept for callers without predicates.
+// It panics on a pattern Add would reject.
 func (r *Router) AddRoute(prefix string, handler http.Handler) {
-    r.routes = append(r.routes, Route{
-        Prefix:  prefix,
-        Handler: handler,
-    })
+	if err := r.Add(Route{Prefix: prefix, Handler: handler}); err != nil {
+		panic(err)
+	}
+}
+
+// Add registers a route, rejecting invalid patterns and routes that would be
+// indistinguishable from one already registered.
+func (r *Router) Add(route Route) error {
+	pattern := route.Pattern()
+	if (route.Prefix == "") == (route.Path == "") {
+		return fmt.Errorf("route needs exactly one of prefix or path")
+	}
+	if !strings.HasPrefix(pattern, "/") {
+		return fmt.Errorf("route %s: pattern must start with /", pattern)
+	}
+
+	e := &entry{route: route, exact: route.Path != ""}
+	n := r.root
+	segs := splitPath(pattern)
+	for i, seg := range segs {
+		switch {
+		case seg == "*":
+			if route.Prefix != "" {
+				return fmt.Errorf("route %s: * is only allowed in path routes", pattern)
+			}
+			if i != len(segs)-1 {
+				return fmt.Errorf("route %s: * must be the last segment", pattern)
+			}
+			e.kinds = append(e.kinds, segWildcard)
+		case strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}"):
+			name := seg[1 : len(seg)-1]
+			if name == "" || slices.Contains(e.params, name) {
+				return fmt.Errorf("route %s: empty or repeated parameter %q", pattern, name)
+			}
+			e.params = append(e.params, name)
+			e.kinds = append(e.kinds, segParam)
+			if n.param == nil {
+				n.param = newNode()
+			}
+			n = n.param
+		case strings.ContainsAny(seg, "{}*"):
+			return fmt.Errorf("route %s: invalid segment %q", pattern, seg)
+		default:
+			e.kinds = append(e.kinds, segStatic)
+			if n.static[seg] == nil {
+				n.static[seg] = newNode()
+			}
+			n = n.static[seg]
+		}
+	}
+
+	for _, other := range r.entries {
+		if ambiguous(e, other) {
+			return fmt.Errorf("route %s is ambiguous with %s: same shape and overlapping methods, host, headers and query",
+				describe(e.route), describe(other.route))
+		}
+	}
+
+	switch {
+	case len(e.kinds) > 0 && e.kinds[len(e.kinds)-1] == segWildcard:
+		n.wildcard = append(n.wildcard, e)
+	case e.exact:
+		n.exact = append(n.exact, e)
+	default:
+		n.prefix = append(n.prefix, e)
+	}
+	r.entries = append(r.entries, e)
+	return nil
+}
+
+// Routes returns the registered routes in registration order
+func (r *Router) Routes() []Route {
+	out := make([]Route, len(r.entries))
+	for i, e := range r.entries {
+		out[i] = e.route
+	}
+	return out
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// match is a candidate route and the request path values it captured
+type match struct {
+	entry  *entry
+	values []string
+}
+
+// collect walks the trie for segs, gathering every route whose path matches
+func (n *node) collect(segs []string, i int, values []string, out *[]match) {
+	for _, e := range n.prefix {
+		*out = append(*out, match{e, slices.Clone(values)})
+	}
+	if i == len(segs) {
+		for _, e := range n.exact {
+			*out = append(*out, match{e, slices.Clone(values)})
+		}
+		return
+	}
+	for _, e := range n.wildcard {
+		*out = append(*out, match{e, slices.Clone(values)})
+	}
+	if child, ok := n.static[segs[i]]; ok {
+		child.collect(segs, i+1, values, out)
+	}
+	if n.param != nil {
+		n.param.collect(segs, i+1, append(values, segs[i]), out)
+	}
+}
+
+// moreSpecific reports whether a should win over b
+func moreSpecific(a, b *entry) bool {
+	for i := 0; i < min(len(a.kinds), len(b.kinds)); i++ {
+		if a.kinds[i] != b.kinds[i] {
+			return a.kinds[i] > b.kinds[i]
+		}
+	}
+	if len(a.kinds) != len(b.kinds) {
+		return len(a.kinds) > len(b.kinds)
+	}
+	if a.exact != b.exact {
+		return a.exact
+	}
+	return predicateCount(a.route) > predicateCount(b.route)
+}
+
+func predicateCount(r Route) int {
+	n := len(r.Headers) + len(r.Query)
+	if len(r.Methods) > 0 {
+		n++
+	}
+	if r.Host != "" {
+		n++
+	}
+	return n
+}
+
+// ambiguous reports whether some request could match a and b with neither
+// being more specific
+func ambiguous(a, b *entry) bool {
+	if !slices.Equal(a.kinds, b.kinds) || a.exact != b.exact || predicateCount(a.route) != predicateCount(b.route) {
+		return false
+	}
+	if splitShape(a) != splitShape(b) {
+		return false
+	}
+
+	ra, rb := a.route, b.route
+	if len(ra.Methods) > 0 && len(rb.Methods) > 0 &&
+		!slices.ContainsFunc(ra.Methods, func(m string) bool { return methodMatches(rb, m) }) {
+		return false
+	}
+	if ra.Host != "" && rb.Host != "" && !strings.EqualFold(ra.Host, rb.Host) &&
+		!strings.HasPrefix(ra.Host, "*.") && !strings.HasPrefix(rb.Host, "*.") {
+		return false
+	}
+	return !conflicting(ra.Headers, rb.Headers) && !conflicting(ra.Query, rb.Query)
+}
+
+// splitShape is the pattern with parameter names erased
+func splitShape(e *entry) string {
+	segs := splitPath(e.route.Pattern())
+	for i, k := range e.kinds {
+		if k == segParam {
+			segs[i] = "{}"
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+// conflicting reports whether two predicate sets require different values
+// for the same key, so no request can satisfy both
+func conflicting(a, b map[string]string) bool {
+	for k, v := range a {
+		for k2, v2 := range b {
+			if strings.EqualFold(k, k2) && v != v2 && v != "*" && v2 != "*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// predicatesMatch checks everything except the path and method
+func predicatesMatch(route Route, req *http.Request) bool {
+	if route.Host != "" && !hostMatches(route.Host, req.Host) {
+		return false
+	}
+	for k, v := range route.Headers {
+		got, ok := req.Header[http.CanonicalHeaderKey(k)]
+		if !ok || (v != "*" && !slices.Contains(got, v)) {
+			return false
+		}
+	}
+	if len(route.Query) > 0 {
+		q := req.URL.Query()
+		for k, v := range route.Query {
+			got, ok := q[k]
+			if !ok || (v != "*" && !slices.Contains(got, v)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func methodMatches(route Route, method string) bool {
+	if len(route.Methods) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(route.Methods, func(m string) bool { return strings.EqualFold(m, method) })
+}
+
+func hostMatches(pattern, host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	pattern = strings.ToLower(pattern)
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+	}
+	return host == pattern
+}
+
+func describe(r Route) string {
+	s := r.Pattern()
+	if len(r.Methods) > 0 {
+		s = strings.Join(r.Methods, ",") + " " + s
+	}
+	if r.Host != "" {
+		s += " host=" + r.Host
+	}
+	for _, k := range slices.Sorted(maps.Keys(r.Headers)) {
+		s += " header:" + k + "=" + r.Headers[k]
+	}
+	for _, k := range slices.Sorted(maps.Keys(r.Query)) {
+		s += " query:" + k + "=" + r.Query[k]
+	}
+	return s
 }
 
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	for _, route := range r.routes {
-		if strings.HasPrefix(req.URL.Path, route.Prefix) {
-			decisionlog.LogDecision(req, decisionlog.DecisionRoute, "Routing to backend", map[string]any{
-				"target": route.Prefix,
-			})
-			route.Handler.ServeHTTP(w, req)
-			return
+	var candidates []match
+	r.root.collect(splitPath(req.URL.Path), 0, nil, &candidates)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return moreSpecific(candidates[i].entry, candidates[j].entry)
+	})
+
+	var allowed []string
+	for _, c := range candidates {
+		route := c.entry.route
+		if !predicatesMatch(route, req) {
+			continue
+		}
+		if !methodMatches(route, req.Method) {
+			allowed = append(allowed, route.Methods...)
+			continue
+		}
+
+		decisionlog.LogDecision(req, decisionlog.DecisionRoute, "Routing to backend", map[string]any{
+			"target": route.Pattern(),
+		})
+		for i, name := range c.entry.params {
+			req.SetPathValue(name, c.values[i])
 		}
+		ctx := context.WithValue(req.Context(), routeKey{}, route.Pattern())
+		route.Handler.ServeHTTP(w, req.WithContext(ctx))
+		return
+	}
+
+	if len(allowed) > 0 {
+		decisionlog.LogDecision(req, decisionlog.DecisionBlock, "Method not allowed", map[string]any{
+			"allowed": allowed,
+		})
+		w.Header().Set("Allow", strings.Join(slices.Compact(slices.Sorted(slices.Values(allowed))), ", "))
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
 
 	decisionlog.LogDecision(req, decisionlog.DecisionBlock, "Route not found", nil)
@@ -0,0 +1,89 @@
+package quota
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/tenant"
+)
+
+// Usage is one counter's state in the current period
+type Usage struct {
+	Period    string    `json:"period"`
+	Route     string    `json:"route,omitempty"`
+	Limit     int64     `json:"limit"`
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at"`
+}
+
+// UsageHandler handles GET /admin/quota/{id}: the tenant's quota and how much
+// of it has been used this day and month.
+func UsageHandler(e *Enforcer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		t, ok := tenant.GetStore().Get(r.PathValue("id"))
+		if !ok {
+			http.Error(w, tenant.ErrNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		q := e.QuotaFor(t)
+		now := time.Now()
+		cs := e.counters(t, "", now)
+		routes := make([]string, 0, len(q.Routes))
+		for route := range q.Routes {
+			routes = append(routes, route)
+		}
+		sort.Strings(routes)
+		for _, route := range routes {
+			for _, c := range e.counters(t, route, now) {
+				if c.route != "" {
+					cs = append(cs, c)
+				}
+			}
+		}
+
+		out := make([]Usage, 0, len(cs))
+		if len(cs) > 0 {
+			keys := make([]string, len(cs))
+			for i, c := range cs {
+				keys[i] = c.key
+			}
+			vals, err := e.redis.MGet(r.Context(), keys...).Result()
+			if err != nil {
+				http.Error(w, "Quota store unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			for i, c := range cs {
+				var used int64
+				if s, ok := vals[i].(string); ok {
+					used, _ = strconv.ParseInt(s, 10, 64)
+				}
+				out = append(out, Usage{
+					Period:    c.period,
+					Route:     c.route,
+					Limit:     c.limit,
+					Used:      used,
+					Remaining: max(c.limit-used, 0),
+					ResetAt:   c.resetAt,
+				})
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"tenant": t.ID,
+			"plan":   t.Plan,
+			"quota":  q,
+			"usage":  out,
+		})
+	}
+}
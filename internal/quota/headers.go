@@ -0,0 +1,88 @@
+package quota
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrorResponse is the JSON body sent with a 429 when a quota is used up. The
+// error code differs from the rate limiter's so clients can tell "slow down"
+// from "come back next period".
+type ErrorResponse struct {
+	Error      string `json:"error"`
+	Message    string `json:"message"`
+	Period     string `json:"period"`
+	Route      string `json:"route,omitempty"`
+	Limit      int64  `json:"limit"`
+	Used       int64  `json:"used"`
+	ResetAt    string `json:"reset_at"`
+	RetryAfter int    `json:"retry_after_sec"`
+}
+
+// headerPeriod names a period in header fields
+var headerPeriod = map[string]string{PeriodDaily: "Daily", PeriodMonthly: "Monthly"}
+
+// setHeaders reports the tenant-wide quota as X-Quota-<Period>-Limit,
+// -Remaining and -Reset (unix time), and adds an X-Quota-Warning for every
+// counter past a warning threshold.
+func setHeaders(w http.ResponseWriter, used []usage, thresholds []int) {
+	h := w.Header()
+	for _, u := range used {
+		if u.route == "" {
+			prefix := "X-Quota-" + headerPeriod[u.period] + "-"
+			h.Set(prefix+"Limit", strconv.FormatInt(u.limit, 10))
+			h.Set(prefix+"Remaining", strconv.FormatInt(max(u.limit-u.used, 0), 10))
+			h.Set(prefix+"Reset", strconv.FormatInt(u.resetAt.Unix(), 10))
+		}
+
+		if p := crossed(u, thresholds); p > 0 {
+			what := u.period + " quota"
+			if u.route != "" {
+				what += " for " + u.route
+			}
+			h.Add("X-Quota-Warning", fmt.Sprintf("%s %d%% used (%d of %d)", what, p, u.used, u.limit))
+		}
+	}
+}
+
+// crossed returns the highest threshold u has reached, or 0
+func crossed(u usage, thresholds []int) int {
+	reached := 0
+	for _, p := range thresholds {
+		if u.used*100 >= u.limit*int64(p) {
+			reached = p
+		}
+	}
+	return reached
+}
+
+// writeExhausted sends the 429 response with Retry-After until the period resets
+func writeExhausted(w http.ResponseWriter, u usage) {
+	retryAfter := max(int(math.Ceil(time.Until(u.resetAt).Seconds())), 1)
+
+	message := "Daily quota exhausted"
+	if u.period == PeriodMonthly {
+		message = "Monthly quota exhausted"
+	}
+	if u.route != "" {
+		message += " for " + u.route
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error:      "quota_exhausted",
+		Message:    message,
+		Period:     u.period,
+		Route:      u.route,
+		Limit:      u.limit,
+		Used:       u.used,
+		ResetAt:    u.resetAt.Format(time.RFC3339),
+		RetryAfter: retryAfter,
+	})
+}
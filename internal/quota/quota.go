@@ -0,0 +1,253 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/decisionlog"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/proxy"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/tenant"
+	"github.com/redis/go-redis/v9"
+)
+
+// Billing periods, aligned to the UTC calendar
+const (
+	PeriodDaily   = "daily"
+	PeriodMonthly = "monthly"
+)
+
+// retention keeps counters readable for billing after their period ends
+const retention = 35 * 24 * time.Hour
+
+// DefaultPlans are the built-in quotas per tier; a tier missing here (or a
+// zero limit) is uncapped. Tenants can override them with their own Quota.
+var DefaultPlans = map[string]tenant.QuotaLimits{
+	tenant.PlanFree: {Daily: 1000, Monthly: 10000},
+	tenant.PlanPro:  {Monthly: 1000000},
+}
+
+// DefaultThresholds are the usage percentages that trigger warning headers
+var DefaultThresholds = []int{80, 95}
+
+// Enforcer counts admitted requests against each tenant's billing quota
+type Enforcer struct {
+	redis *redis.Client
+
+	mu         sync.RWMutex
+	plans      map[string]tenant.QuotaLimits
+	thresholds []int
+}
+
+func NewEnforcer(redis *redis.Client) *Enforcer {
+	e := &Enforcer{
+		redis:      redis,
+		plans:      make(map[string]tenant.QuotaLimits, len(DefaultPlans)),
+		thresholds: slices.Clone(DefaultThresholds),
+	}
+	for name, l := range DefaultPlans {
+		e.plans[name] = l
+	}
+	return e
+}
+
+// SetPlan sets the quota for a tier; it applies to the next request
+func (e *Enforcer) SetPlan(name string, l tenant.QuotaLimits) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.plans[name] = l
+}
+
+// SetThresholds replaces the warning percentages, e.g. 80 and 95
+func (e *Enforcer) SetThresholds(thresholds []int) error {
+	for _, p := range thresholds {
+		if p <= 0 || p >= 100 {
+			return fmt.Errorf("threshold %d%% must be between 1 and 99", p)
+		}
+	}
+	thresholds = slices.Clone(thresholds)
+	sort.Ints(thresholds)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.thresholds = thresholds
+	return nil
+}
+
+// QuotaFor returns the quota that applies to t
+func (e *Enforcer) QuotaFor(t *tenant.Tenant) tenant.Quota {
+	if t.Quota != nil {
+		return *t.Quota
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return tenant.Quota{QuotaLimits: e.plans[t.Plan]}
+}
+
+// counter is one Redis key a request is charged to
+type counter struct {
+	period  string
+	route   string // empty for the tenant-wide quota
+	key     string
+	limit   int64
+	resetAt time.Time
+}
+
+// counters lists the capped counters for t on route at now
+func (e *Enforcer) counters(t *tenant.Tenant, route string, now time.Time) []counter {
+	q := e.QuotaFor(t)
+
+	var out []counter
+	add := func(route string, l tenant.QuotaLimits) {
+		if l.Daily > 0 {
+			out = append(out, newCounter(t.ID, PeriodDaily, route, l.Daily, now))
+		}
+		if l.Monthly > 0 {
+			out = append(out, newCounter(t.ID, PeriodMonthly, route, l.Monthly, now))
+		}
+	}
+	add("", q.QuotaLimits)
+	if l, ok := q.Routes[route]; ok && route != "" {
+		add(route, l)
+	}
+	return out
+}
+
+func newCounter(tenantID, period, route string, limit int64, now time.Time) counter {
+	now = now.UTC()
+	var stamp string
+	var resetAt time.Time
+	switch period {
+	case PeriodDaily:
+		stamp = now.Format("2006-01-02")
+		resetAt = time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	default:
+		stamp = now.Format("2006-01")
+		resetAt = time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	// The hash tag keeps all of a tenant's counters in one cluster slot so
+	// the script can touch them together.
+	key := "quota:{" + tenantID + "}:" + period + ":" + stamp
+	if route != "" {
+		key = "quota:{" + tenantID + "}:route:" + route + ":" + period + ":" + stamp
+	}
+	return counter{period: period, route: route, key: key, limit: limit, resetAt: resetAt}
+}
+
+// consumeScript charges one request to every counter in KEYS, or to none of
+// them if any is already at its limit. ARGV holds the limits followed by the
+// expiry (unix ms) of each key. Returns {1, 0, used...} when admitted or
+// {0, index, used} for the first exhausted counter (1-based).
+var consumeScript = redis.NewScript(`
+local n = #KEYS
+for i = 1, n do
+  local used = tonumber(redis.call('GET', KEYS[i]) or '0')
+  if used >= tonumber(ARGV[i]) then
+    return {0, i, used}
+  end
+end
+local out = {1, 0}
+for i = 1, n do
+  out[i + 2] = redis.call('INCR', KEYS[i])
+  redis.call('PEXPIREAT', KEYS[i], ARGV[n + i])
+end
+return out
+`)
+
+// usage is a counter's state after a request
+type usage struct {
+	counter
+	used int64
+}
+
+// consume charges the request to cs. exhausted is the counter that blocked
+// it, if any; otherwise used holds the new count of every counter.
+func (e *Enforcer) consume(ctx context.Context, cs []counter) (used []usage, exhausted *usage, err error) {
+	keys := make([]string, len(cs))
+	args := make([]any, 0, 2*len(cs))
+	for i, c := range cs {
+		keys[i] = c.key
+		args = append(args, c.limit)
+	}
+	for _, c := range cs {
+		args = append(args, c.resetAt.Add(retention).UnixMilli())
+	}
+
+	vals, err := consumeScript.Run(ctx, e.redis, keys, args...).Int64Slice()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(vals) < 3 {
+		return nil, nil, fmt.Errorf("unexpected script reply %v", vals)
+	}
+
+	if vals[0] == 0 {
+		i := int(vals[1]) - 1
+		if i < 0 || i >= len(cs) {
+			return nil, nil, fmt.Errorf("unexpected script reply %v", vals)
+		}
+		return nil, &usage{counter: cs[i], used: vals[2]}, nil
+	}
+
+	used = make([]usage, len(cs))
+	for i, c := range cs {
+		used[i] = usage{counter: c, used: vals[i+2]}
+	}
+	return used, nil, nil
+}
+
+// Middleware charges each admitted request to the tenant's quota. It belongs
+// inside the rate limiter so that throttled requests are not billed.
+func (e *Enforcer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t, ok := tenant.FromContext(r.Context())
+		if !ok {
+			decisionlog.LogDecision(r, decisionlog.DecisionBlock, "Tenant not found for quota", nil)
+			http.Error(w, "Tenant not found", http.StatusUnauthorized)
+			return
+		}
+
+		route, _ := proxy.RouteFromContext(r.Context())
+		cs := e.counters(t, route, time.Now())
+		if len(cs) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		used, exhausted, err := e.consume(r.Context(), cs)
+		if err != nil {
+			// Billing quotas are not worth an outage; admit and say so
+			decisionlog.LogDecision(r, decisionlog.DecisionAllow, "Quota check skipped, Redis unavailable", map[string]any{
+				"tenant": t.ID,
+				"error":  err.Error(),
+			})
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if exhausted != nil {
+			decisionlog.LogDecision(r, decisionlog.DecisionBlock, "Quota exhausted", map[string]any{
+				"tenant":   t.ID,
+				"period":   exhausted.period,
+				"route":    exhausted.route,
+				"limit":    exhausted.limit,
+				"used":     exhausted.used,
+				"reset_at": exhausted.resetAt,
+			})
+			writeExhausted(w, *exhausted)
+			return
+		}
+
+		e.mu.RLock()
+		thresholds := e.thresholds
+		e.mu.RUnlock()
+		setHeaders(w, used, thresholds)
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/decisionlog"
+)
+
+// PlansHandler handles GET /admin/plans (list tiers) and PUT /admin/plans
+// (change a tier's limit). Changes are stored in Redis and apply to the next
+// request of every tenant on that tier, on every replica.
+func PlansHandler(rl *RateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(rl.Plans())
+
+		case http.MethodPut:
+			var p Plan
+			if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			if err := p.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := rl.SavePlan(r.Context(), p); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+
+			decisionlog.LogDecision(r, decisionlog.DecisionConfig, "Rate limit plan updated", map[string]any{
+				"plan":       p.Name,
+				"limit":      p.Limit,
+				"window_sec": p.WindowSec,
+				"algorithm":  p.Algorithm,
+				"burst":      p.Burst,
+			})
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(p)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// RulesHandler handles GET /admin/ratelimit/rules (list stacked rules) and
+// PUT /admin/ratelimit/rules (replace them all). The new set applies to the
+// next request. With a rules file the file wins: every config reload
+// re-reads it, so PUT is refused rather than silently undone.
+func RulesHandler(rl *RateLimiter, rulesFile string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(rl.Rules())
+
+		case http.MethodPut:
+			if rulesFile != "" {
+				http.Error(w, "rules are loaded from "+rulesFile+"; edit the file and reload", http.StatusConflict)
+				return
+			}
+			var rules []Rule
+			if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			if err := rl.SetRules(rules); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			names := make([]string, len(rules))
+			for i, rule := range rules {
+				names[i] = rule.Name
+			}
+			decisionlog.LogDecision(r, decisionlog.DecisionConfig, "Rate limit rules replaced", map[string]any{
+				"rules": names,
+			})
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(rules)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Failure policies applied when Redis cannot be reached
+const (
+	FailOpen   = "open"   // admit every request unchecked
+	FailClosed = "closed" // reject with 503
+	FailLocal  = "local"  // enforce an in-process share of the limit
+)
+
+// ValidFailurePolicy reports whether name is a known failure policy
+func ValidFailurePolicy(name string) bool {
+	return name == FailOpen || name == FailClosed || name == FailLocal
+}
+
+// probeInterval is how often a degraded limiter retries Redis; in between,
+// requests go straight to the fallback instead of waiting on a dial timeout.
+const probeInterval = time.Second
+
+var errDegraded = errors.New("redis unavailable, waiting to retry")
+
+// maxLocalBuckets bounds the fallback limiter's memory during a long outage
+const maxLocalBuckets = 10000
+
+// localLimiter is an in-process token bucket per key. With N replicas behind
+// a load balancer each one admits roughly 1/N of the plan, so the cluster as
+// a whole stays close to the configured limit while Redis is down.
+type localLimiter struct {
+	mu       sync.Mutex
+	replicas int
+	buckets  map[string]*localBucket
+}
+
+type localBucket struct {
+	tokens float64
+	ts     time.Time
+}
+
+func newLocalLimiter(replicas int) *localLimiter {
+	return &localLimiter{replicas: max(replicas, 1), buckets: make(map[string]*localBucket)}
+}
+
+// allow checks every counter and, as the Redis script does, charges them
+// only if all have room
+func (l *localLimiter) allow(checks []check) (results []Result, admitted bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	buckets := make([]*localBucket, len(checks))
+	capacities := make([]float64, len(checks))
+	rates := make([]float64, len(checks))
+	admitted = true
+	for i, c := range checks {
+		capacities[i] = math.Max(1, math.Ceil(float64(c.plan.Capacity())/float64(l.replicas)))
+		rates[i] = float64(c.plan.Limit) / float64(l.replicas) / float64(c.plan.Window().Milliseconds()) // tokens/ms
+
+		b, ok := l.buckets[c.key]
+		if !ok {
+			if len(l.buckets) >= maxLocalBuckets {
+				l.prune(now)
+			}
+			b = &localBucket{tokens: capacities[i], ts: now}
+			l.buckets[c.key] = b
+		}
+		b.tokens = math.Min(capacities[i], b.tokens+float64(now.Sub(b.ts).Milliseconds())*rates[i])
+		b.ts = now
+		buckets[i] = b
+		admitted = admitted && b.tokens >= 1
+	}
+
+	results = make([]Result, len(checks))
+	for i, b := range buckets {
+		res := Result{Limit: int(capacities[i]), Allowed: b.tokens >= 1}
+		if admitted {
+			b.tokens--
+		}
+		if !res.Allowed {
+			res.RetryAfter = time.Duration(math.Ceil((1-b.tokens)/rates[i])) * time.Millisecond
+		}
+		res.Remaining = int(b.tokens)
+		res.ResetAfter = time.Duration(math.Ceil((capacities[i]-b.tokens)/rates[i])) * time.Millisecond
+		results[i] = res
+	}
+	return results, admitted
+}
+
+// prune drops buckets idle for over a minute; called with mu held
+func (l *localLimiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.ts) > time.Minute {
+			delete(l.buckets, key)
+		}
+	}
+	// Still full: everyone is active, so start over rather than grow
+	if len(l.buckets) >= maxLocalBuckets {
+		clear(l.buckets)
+	}
+}
+
+// HealthStatus is the limiter's view of its Redis backend
+type HealthStatus struct {
+	Status    string     `json:"status"` // ok or degraded
+	Policy    string     `json:"failure_policy"`
+	Replicas  int        `json:"replicas"`
+	Since     *time.Time `json:"degraded_since,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	Fallbacks uint64     `json:"fallback_decisions"`
+}
+
+// health tracks whether the last Redis call failed
+type health struct {
+	mu        sync.Mutex
+	degraded  bool
+	since     time.Time
+	lastError string
+	lastFail  time.Time
+	fallbacks uint64
+}
+
+// shouldTry reports whether Redis should be asked; false while degraded and
+// the last failure was under probeInterval ago.
+func (h *health) shouldTry() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return !h.degraded || time.Since(h.lastFail) >= probeInterval
+}
+
+func (h *health) fail(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.degraded {
+		h.degraded = true
+		h.since = time.Now()
+		log.Printf("[RATELIMIT] Redis unavailable, switching to fallback: %v", err)
+	}
+	if err != errDegraded {
+		h.lastError = err.Error()
+		h.lastFail = time.Now()
+	}
+	h.fallbacks++
+}
+
+// skipped counts a fallback decision that was not Redis's fault
+func (h *health) skipped() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fallbacks++
+}
+
+func (h *health) ok() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.degraded {
+		h.degraded = false
+		log.Printf("[RATELIMIT] Redis recovered after %s", time.Since(h.since).Round(time.Second))
+	}
+}
+
+// SetFailurePolicy selects what happens when Redis is unavailable. replicas
+// is the number of gateway instances sharing the limit; the local policy
+// admits 1/replicas of each plan per instance.
+func (rl *RateLimiter) SetFailurePolicy(policy string, replicas int) error {
+	if !ValidFailurePolicy(policy) {
+		return fmt.Errorf("unknown failure policy %q", policy)
+	}
+	if replicas < 1 {
+		return fmt.Errorf("replicas must be at least 1")
+	}
+
+	rl.policyMu.Lock()
+	defer rl.policyMu.Unlock()
+	rl.policy = policy
+	rl.local = newLocalLimiter(replicas)
+	return nil
+}
+
+func (rl *RateLimiter) failurePolicy() (string, *localLimiter) {
+	rl.policyMu.RLock()
+	defer rl.policyMu.RUnlock()
+	return rl.policy, rl.local
+}
+
+// unreachable reports whether err means Redis could not be reached, as
+// opposed to a script or plan error that retrying would not fix
+func unreachable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return err == errDegraded || errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, redis.ErrClosed) || errors.Is(err, redis.ErrPoolTimeout) || errors.Is(err, redis.ErrPoolExhausted)
+}
+
+// fallback decides checks that Redis could not answer. ok is false when the
+// policy is fail-closed; fail-open admits with no results, so no limit
+// information is sent. Only connection failures mark Redis degraded.
+func (rl *RateLimiter) fallback(checks []check, err error) (results []Result, admitted bool, policy string, ok bool) {
+	if unreachable(err) {
+		rl.health.fail(err)
+	} else {
+		log.Printf("[RATELIMIT] check failed, applying failure policy: %v", err)
+		rl.health.skipped()
+	}
+
+	policy, local := rl.failurePolicy()
+	switch policy {
+	case FailOpen:
+		return nil, true, policy, true
+	case FailLocal:
+		results, admitted = local.allow(checks)
+		return results, admitted, policy, true
+	default:
+		return nil, false, policy, false
+	}
+}
+
+// Health reports whether the limiter is currently running on its fallback
+func (rl *RateLimiter) Health() HealthStatus {
+	policy, local := rl.failurePolicy()
+
+	h := &rl.health
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := HealthStatus{Status: "ok", Policy: policy, Replicas: local.replicas, Fallbacks: h.fallbacks}
+	if h.degraded {
+		since := h.since
+		s.Status = "degraded"
+		s.Since = &since
+		s.LastError = h.lastError
+	}
+	return s
+}
+
+// HealthHandler handles GET /admin/ratelimit/health. It answers 200 even
+// while degraded (the gateway is still serving); callers read "status".
+func HealthHandler(rl *RateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rl.Health())
+	}
+}
@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrorResponse is the JSON body sent with a 429
+type ErrorResponse struct {
+	Error      string `json:"error"`
+	Message    string `json:"message"`
+	Limit      int    `json:"limit"`
+	Remaining  int    `json:"remaining"`
+	RetryAfter int    `json:"retry_after_sec"`
+}
+
+// setHeaders advertises quota state using the IETF draft RateLimit-* fields
+// and the legacy X-RateLimit-* fields still expected by many clients.
+func setHeaders(w http.ResponseWriter, res Result, plan Plan) {
+	h := w.Header()
+	remaining := strconv.Itoa(max(res.Remaining, 0))
+	reset := ceilSeconds(res.ResetAfter)
+
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("RateLimit-Remaining", remaining)
+	h.Set("RateLimit-Reset", strconv.Itoa(reset))
+	h.Set("RateLimit-Policy", strconv.Itoa(plan.Limit)+";w="+strconv.Itoa(plan.WindowSec))
+
+	h.Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("X-RateLimit-Remaining", remaining)
+	// Legacy header carries an absolute Unix time rather than a delta
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(res.ResetAfter).Unix(), 10))
+}
+
+// writeExceeded sends the 429 response with Retry-After and a JSON body
+func writeExceeded(w http.ResponseWriter, res Result) {
+	retryAfter := max(ceilSeconds(res.RetryAfter), 1)
+
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error:      "rate_limit_exceeded",
+		Message:    "Rate limit exceeded",
+		Limit:      res.Limit,
+		Remaining:  max(res.Remaining, 0),
+		RetryAfter: retryAfter,
+	})
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
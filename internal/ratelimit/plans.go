@@ -0,0 +1,174 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/tenant"
+)
+
+const (
+	// redisPlansKey is a hash of plan name -> JSON encoded Plan holding the
+	// tier limits changed at runtime, shared by every replica
+	redisPlansKey = "gateway:ratelimit:plans"
+	// redisPlansChannel is published to after every change so that all
+	// replicas reload the overrides
+	redisPlansChannel = "gateway:ratelimit:plans:changed"
+)
+
+// Plan is the rate limit applied to every tenant on a tier
+type Plan struct {
+	Name      string `json:"name"`
+	Limit     int    `json:"limit"`
+	WindowSec int    `json:"window_sec"`
+	Algorithm string `json:"algorithm,omitempty"` // token_bucket (default) or sliding_window
+	Burst     int    `json:"burst,omitempty"`     // token bucket capacity; 0 = Limit
+}
+
+func (p Plan) Window() time.Duration {
+	return time.Duration(p.WindowSec) * time.Second
+}
+
+// Capacity is the number of requests a full token bucket admits at once
+func (p Plan) Capacity() int {
+	if p.Burst > 0 {
+		return p.Burst
+	}
+	return p.Limit
+}
+
+// Validate reports the first problem with a tier definition
+func (p Plan) Validate() error {
+	if p.Name == "" || p.Name == tenant.PlanCustom || !tenant.ValidPlan(p.Name) {
+		return errors.New("name must be free, pro or enterprise")
+	}
+	if p.Limit <= 0 || p.WindowSec <= 0 || p.Burst < 0 {
+		return errors.New("limit and window_sec must be positive")
+	}
+	if !validAlgorithm(p.Algorithm) {
+		return errors.New("algorithm must be token_bucket or sliding_window")
+	}
+	return nil
+}
+
+// validAlgorithm reports whether name selects a known algorithm
+func validAlgorithm(name string) bool {
+	return name == "" || name == AlgorithmTokenBucket || name == AlgorithmSlidingWindow
+}
+
+// DefaultPlans are the built-in tier limits; they can be changed at runtime
+// through the plans admin endpoint.
+var DefaultPlans = []Plan{
+	{Name: tenant.PlanFree, Limit: 5, WindowSec: 60},
+	{Name: tenant.PlanPro, Limit: 100, WindowSec: 60},
+	{Name: tenant.PlanEnterprise, Limit: 1000, WindowSec: 60},
+}
+
+// planTable is the runtime-editable set of tier limits
+type planTable struct {
+	mu    sync.RWMutex
+	plans map[string]Plan
+}
+
+func newPlanTable(plans []Plan) *planTable {
+	t := &planTable{plans: make(map[string]Plan, len(plans))}
+	for _, p := range plans {
+		t.plans[p.Name] = p
+	}
+	return t
+}
+
+func (t *planTable) get(name string) (Plan, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	p, ok := t.plans[name]
+	return p, ok
+}
+
+func (t *planTable) set(p Plan) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.plans[p.Name] = p
+}
+
+func (t *planTable) list() []Plan {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	out := make([]Plan, 0, len(t.plans))
+	for _, p := range t.plans {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// SavePlan stores a tier definition in Redis and applies it. Every replica
+// picks it up through LoadPlans, on the change notification or its next
+// periodic reload, and it outlives restarts.
+func (rl *RateLimiter) SavePlan(ctx context.Context, p Plan) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	pipe := rl.redis.TxPipeline()
+	pipe.HSet(ctx, redisPlansKey, p.Name, data)
+	pipe.Publish(ctx, redisPlansChannel, p.Name)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("save plan: %w", err)
+	}
+	rl.plans.set(p)
+	return nil
+}
+
+// LoadPlans applies the tier definitions stored by SavePlan
+func (rl *RateLimiter) LoadPlans(ctx context.Context) error {
+	raw, err := rl.redis.HGetAll(ctx, redisPlansKey).Result()
+	if err != nil {
+		return fmt.Errorf("load plans: %w", err)
+	}
+	for name, data := range raw {
+		var p Plan
+		if err := json.Unmarshal([]byte(data), &p); err != nil {
+			log.Printf("[RATELIMIT] skipping stored plan %q: %v", name, err)
+			continue
+		}
+		p.Name = name
+		if err := p.Validate(); err != nil {
+			log.Printf("[RATELIMIT] skipping stored plan %q: %v", name, err)
+			continue
+		}
+		rl.plans.set(p)
+	}
+	return nil
+}
+
+// WatchPlans reloads the stored tier definitions whenever a change is
+// published and every interval
+func (rl *RateLimiter) WatchPlans(interval time.Duration) {
+	ctx := context.Background()
+
+	go func() {
+		sub := rl.redis.Subscribe(ctx, redisPlansChannel)
+		defer sub.Close()
+		for range sub.Channel() {
+			if err := rl.LoadPlans(ctx); err != nil {
+				log.Printf("[RATELIMIT] plan reload failed: %v", err)
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			time.Sleep(interval)
+			if err := rl.LoadPlans(ctx); err != nil {
+				log.Printf("[RATELIMIT] plan reload failed: %v", err)
+			}
+		}
+	}()
+}
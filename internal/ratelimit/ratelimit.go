@@ -1,28 +1,127 @@
 package ratelimit
 
 import (
-    "context"
-    "net/http"
-    "strconv"
-    "time"
-
-    "github.com/redis/go-redis/v9"
-    "github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/tenant"
-    "github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/decisionlog"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/decisionlog"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/tenant"
+	"github.com/redis/go-redis/v9"
 )
 
 type RateLimiter struct {
-    redis *redis.Client
-    limit int
-    refill time.Duration
+	redis  *redis.Client
+	limit  int
+	refill time.Duration
+	plans  *planTable
+
+	rulesMu sync.RWMutex
+	rules   []Rule
+
+	policyMu sync.RWMutex
+	policy   string
+	local    *localLimiter
+	health   health
 }
-// constructor to make rate limiting configure. 
+
+// constructor to make rate limiting configure.
+// limit/refill apply to tenants without a plan; tiers start from DefaultPlans.
+// If Redis fails, a single-replica local limiter takes over until
+// SetFailurePolicy says otherwise.
 func NewRateLimiter(redis *redis.Client, limit int, refill time.Duration) *RateLimiter {
-    return &RateLimiter{
-        redis: redis,
-        limit: limit,
-        refill: refill,
-    }
+	return &RateLimiter{
+		redis:  redis,
+		limit:  limit,
+		refill: refill,
+		plans:  newPlanTable(DefaultPlans),
+		policy: FailLocal,
+		local:  newLocalLimiter(1),
+	}
+}
+
+// SetPlan adds or replaces a tier definition; it applies to the next request
+func (rl *RateLimiter) SetPlan(p Plan) {
+	rl.plans.set(p)
+}
+
+// Plans returns the current tier definitions
+func (rl *RateLimiter) Plans() []Plan {
+	return rl.plans.list()
+}
+
+// ValidateRules reports the first problem with a set of stacked rules
+func ValidateRules(rules []Rule) error {
+	seen := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+		if seen[rule.Name] {
+			return fmt.Errorf("duplicate rule %q", rule.Name)
+		}
+		seen[rule.Name] = true
+	}
+	return nil
+}
+
+// SetRules replaces the stacked limit rules; it applies to the next request
+func (rl *RateLimiter) SetRules(rules []Rule) error {
+	if err := ValidateRules(rules); err != nil {
+		return err
+	}
+
+	rl.rulesMu.Lock()
+	defer rl.rulesMu.Unlock()
+	rl.rules = slices.Clone(rules)
+	return nil
+}
+
+// Rules returns the stacked limit rules
+func (rl *RateLimiter) Rules() []Rule {
+	rl.rulesMu.RLock()
+	defer rl.rulesMu.RUnlock()
+	return slices.Clone(rl.rules)
+}
+
+// check is one counter a request must pass
+type check struct {
+	rule string
+	key  string
+	plan Plan
+}
+
+// checksFor lists the tenant's plan followed by every matching rule
+func (rl *RateLimiter) checksFor(r *http.Request, t *tenant.Tenant) []check {
+	plan := rl.PlanFor(t)
+	checks := []check{{rule: "plan", key: "ratelimit:" + t.ID, plan: plan}}
+	for _, rule := range rl.Rules() {
+		if key, ok := rule.key(r, t); ok {
+			checks = append(checks, check{rule: rule.Name, key: key, plan: rule.plan()})
+		}
+	}
+	return checks
+}
+
+// PlanFor returns the limit that applies to t on this request
+func (rl *RateLimiter) PlanFor(t *tenant.Tenant) Plan {
+	if t.Plan == tenant.PlanCustom && t.RateLimit != nil {
+		return Plan{
+			Name:      tenant.PlanCustom,
+			Limit:     t.RateLimit.Limit,
+			WindowSec: t.RateLimit.WindowSec,
+			Algorithm: t.RateLimit.Algorithm,
+			Burst:     t.RateLimit.Burst,
+		}
+	}
+	if p, ok := rl.plans.get(t.Plan); ok {
+		return p
+	}
+	return Plan{Name: "default", Limit: rl.limit, WindowSec: int(rl.refill / time.Second)}
 }
 
 func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
@@ -34,40 +133,98 @@ func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
 			return
 		}
 
-		key := "ratelimit:" + t.ID
-		ctx := context.Background()
-
-		tokensStr, err := rl.redis.Get(ctx, key).Result()
-		if err == redis.Nil {
-			rl.redis.Set(ctx, key, rl.limit-1, rl.refill)
-			decisionlog.LogDecision(r, decisionlog.DecisionAllow, "Rate limit OK (first request)", map[string]any{
-				"tenant": t.ID,
-				"limit":  rl.limit,
-				"used":   1,
-			})
-			next.ServeHTTP(w, r)
+		plan := rl.PlanFor(t)
+
+		// All checks are decided at once and charged only if every one has
+		// room. The headers describe whichever counter is closest to running
+		// out, or the first one that blocked.
+		checks := rl.checksFor(r, t)
+		var (
+			results  []Result
+			fallback string // failure policy in use, if Redis failed
+			err      = errDegraded
+		)
+		if rl.health.shouldTry() {
+			results, _, err = rl.allow(r.Context(), checks)
+		}
+		if err != nil && r.Context().Err() != nil {
+			// The request ended while Redis was being asked; that says
+			// nothing about Redis
+			if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+				decisionlog.LogDecision(r, decisionlog.DecisionBlock, "Request deadline exceeded", map[string]any{
+					"during": "rate limit check",
+				})
+				w.WriteHeader(http.StatusGatewayTimeout)
+			}
 			return
 		}
+		if err != nil {
+			var ok bool
+			results, _, fallback, ok = rl.fallback(checks, err)
+			if !ok {
+				decisionlog.LogDecision(r, decisionlog.DecisionBlock, "Rate limiter unavailable", map[string]any{
+					"tenant":   t.ID,
+					"fallback": fallback,
+					"error":    err.Error(),
+				})
+				http.Error(w, "Rate limiter unavailable", http.StatusServiceUnavailable)
+				return
+			}
+		} else {
+			rl.health.ok()
+		}
 
-		tokens, _ := strconv.Atoi(tokensStr)
-		if tokens <= 0 {
-			decisionlog.LogDecision(r, decisionlog.DecisionBlock, "Rate limit exceeded", map[string]any{
-				"tenant": t.ID,
-				"limit":  rl.limit,
-				"used":   tokens,
-			})
-			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
-			return
+		var (
+			tightest     Result
+			tightestPlan Plan
+			haveTightest bool
+		)
+		for i, res := range results {
+			c := checks[i]
+			if !res.Allowed {
+				setHeaders(w, res, c.plan)
+				extra := map[string]any{
+					"tenant":         t.ID,
+					"plan":           plan.Name,
+					"blocked_by":     c.rule,
+					"algorithm":      c.plan.Algorithm,
+					"limit":          res.Limit,
+					"retry_after_ms": res.RetryAfter.Milliseconds(),
+				}
+				if fallback != "" {
+					extra["fallback"] = fallback
+				}
+				decisionlog.LogDecision(r, decisionlog.DecisionBlock, "Rate limit exceeded", extra)
+				writeExceeded(w, res)
+				return
+			}
+
+			if !haveTightest || res.Remaining < tightest.Remaining {
+				tightest, tightestPlan, haveTightest = res, c.plan, true
+			}
+		}
+		if haveTightest {
+			setHeaders(w, tightest, tightestPlan)
 		}
 
-		rl.redis.Decr(ctx, key)
-		decisionlog.LogDecision(r, decisionlog.DecisionAllow, "Rate limit OK", map[string]any{
-			"tenant": t.ID,
-			"limit":  rl.limit,
-			"used":   tokens,
-		})
+		reason := "Rate limit OK"
+		extra := map[string]any{
+			"tenant":    t.ID,
+			"plan":      plan.Name,
+			"algorithm": plan.Algorithm,
+			"limit":     tightest.Limit,
+			"remaining": tightest.Remaining,
+		}
+		switch fallback {
+		case FailOpen:
+			reason = "Rate limit skipped, Redis unavailable (fail-open)"
+			extra["fallback"] = fallback
+		case FailLocal:
+			reason = "Rate limit OK (local fallback)"
+			extra["fallback"] = fallback
+		}
+		decisionlog.LogDecision(r, decisionlog.DecisionAllow, reason, extra)
 
 		next.ServeHTTP(w, r)
 	})
 }
-
@@ -0,0 +1,205 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/tenant"
+)
+
+// newTestLimiter runs a limiter against miniredis with its clock frozen at
+// the returned time; the scripts read the clock through TIME.
+func newTestLimiter(t *testing.T) (*RateLimiter, *miniredis.Miniredis, time.Time) {
+	t.Helper()
+	m := miniredis.RunT(t)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.SetTime(now)
+	rdb := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return NewRateLimiter(rdb, 5, time.Minute), m, now
+}
+
+// allowOne runs a single check
+func allowOne(rl *RateLimiter, key string, plan Plan) (Result, error) {
+	results, _, err := rl.allow(context.Background(), []check{{rule: "test", key: key, plan: plan}})
+	if err != nil {
+		return Result{}, err
+	}
+	return results[0], nil
+}
+
+// burst fires n concurrent checks at key and counts the admitted ones
+func burst(t *testing.T, rl *RateLimiter, key string, plan Plan, n int) int {
+	t.Helper()
+	return burstChecks(t, rl, []check{{rule: "test", key: key, plan: plan}}, n)
+}
+
+// burstChecks fires n concurrent requests that must pass all checks and
+// counts the admitted ones
+func burstChecks(t *testing.T, rl *RateLimiter, checks []check, n int) int {
+	t.Helper()
+	var (
+		wg      sync.WaitGroup
+		allowed atomic.Int64
+	)
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, admitted, err := rl.allow(context.Background(), checks)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if admitted {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	return int(allowed.Load())
+}
+
+func TestTokenBucketBurstAdmitsCapacity(t *testing.T) {
+	rl, _, _ := newTestLimiter(t)
+	plan := Plan{Name: "test", Limit: 10, WindowSec: 60, Burst: 15}
+
+	if got := burst(t, rl, "ratelimit:t1", plan, 100); got != plan.Capacity() {
+		t.Fatalf("admitted %d of a burst of 100, want capacity %d", got, plan.Capacity())
+	}
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	rl, m, now := newTestLimiter(t)
+	plan := Plan{Name: "test", Limit: 10, WindowSec: 10} // one token per second
+
+	if got := burst(t, rl, "ratelimit:t1", plan, 20); got != 10 {
+		t.Fatalf("admitted %d of the first burst, want 10", got)
+	}
+	res, err := allowOne(rl, "ratelimit:t1", plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed || res.RetryAfter != time.Second {
+		t.Fatalf("empty bucket: allowed %v, retry after %v; want denied, 1s", res.Allowed, res.RetryAfter)
+	}
+
+	m.SetTime(now.Add(3 * time.Second))
+	if got := burst(t, rl, "ratelimit:t1", plan, 20); got != 3 {
+		t.Fatalf("admitted %d after 3s, want 3 refilled tokens", got)
+	}
+
+	m.SetTime(now.Add(time.Hour))
+	if got := burst(t, rl, "ratelimit:t1", plan, 20); got != 10 {
+		t.Fatalf("admitted %d after a long idle, want capacity 10", got)
+	}
+}
+
+func TestSlidingWindowBurstAdmitsLimit(t *testing.T) {
+	rl, _, _ := newTestLimiter(t)
+	plan := Plan{Name: "test", Limit: 7, WindowSec: 60, Algorithm: AlgorithmSlidingWindow}
+
+	if got := burst(t, rl, "ratelimit:t1", plan, 100); got != plan.Limit {
+		t.Fatalf("admitted %d of a burst of 100, want limit %d", got, plan.Limit)
+	}
+}
+
+func TestSlidingWindowEviction(t *testing.T) {
+	rl, m, now := newTestLimiter(t)
+	plan := Plan{Name: "test", Limit: 5, WindowSec: 10, Algorithm: AlgorithmSlidingWindow}
+
+	if got := burst(t, rl, "ratelimit:t1", plan, 5); got != 5 {
+		t.Fatalf("admitted %d at t=0, want 5", got)
+	}
+
+	// Still inside the window: nothing has aged out
+	m.SetTime(now.Add(9 * time.Second))
+	res, err := allowOne(rl, "ratelimit:t1", plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed {
+		t.Fatal("admitted a request while the window was full")
+	}
+	if res.RetryAfter != time.Second {
+		t.Fatalf("retry after %v, want 1s until the oldest entry leaves", res.RetryAfter)
+	}
+
+	// The t=0 entries leave the window; the full limit is available again
+	m.SetTime(now.Add(10*time.Second + time.Millisecond))
+	if got := burst(t, rl, "ratelimit:t1", plan, 20); got != 5 {
+		t.Fatalf("admitted %d after the window slid, want 5", got)
+	}
+}
+
+func TestKeysAreIndependent(t *testing.T) {
+	rl, _, _ := newTestLimiter(t)
+	plan := Plan{Name: "test", Limit: 3, WindowSec: 60}
+
+	if got := burst(t, rl, "ratelimit:a", plan, 10); got != 3 {
+		t.Fatalf("key a admitted %d, want 3", got)
+	}
+	if got := burst(t, rl, "ratelimit:b", plan, 10); got != 3 {
+		t.Fatalf("key b admitted %d after a was drained, want 3", got)
+	}
+}
+
+func TestBlockedRequestChargesNoCounter(t *testing.T) {
+	rl, _, _ := newTestLimiter(t)
+	planCheck := check{rule: "plan", key: "ratelimit:t1", plan: Plan{Name: "pro", Limit: 10, WindowSec: 60}}
+	ruleCheck := check{rule: "route", key: "ratelimit:rule:route:t1", plan: Plan{Name: "route", Limit: 2, WindowSec: 60, Algorithm: AlgorithmSlidingWindow}}
+
+	if got := burstChecks(t, rl, []check{planCheck, ruleCheck}, 20); got != 2 {
+		t.Fatalf("admitted %d through plan and rule, want the rule's 2", got)
+	}
+	// The 18 requests the rule blocked must not have spent plan tokens
+	if got := burst(t, rl, planCheck.key, planCheck.plan, 20); got != 8 {
+		t.Fatalf("plan admitted %d on its own afterwards, want the 8 left", got)
+	}
+}
+
+func TestOnlyConnectionErrorsDegrade(t *testing.T) {
+	rl, m, _ := newTestLimiter(t)
+	plan := Plan{Name: "test", Limit: 3, WindowSec: 60}
+
+	_, err := allowOne(rl, "ratelimit:t1", Plan{Name: "broken"})
+	if err == nil || unreachable(err) {
+		t.Fatalf("invalid plan: error %v counted as Redis unreachable", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = rl.allow(ctx, []check{{rule: "test", key: "ratelimit:t1", plan: plan}})
+	if err == nil || unreachable(err) {
+		t.Fatalf("canceled request: error %v counted as Redis unreachable", err)
+	}
+
+	m.Close()
+	if _, err := allowOne(rl, "ratelimit:t1", plan); err == nil || !unreachable(err) {
+		t.Fatalf("Redis down: error %v not counted as unreachable", err)
+	}
+}
+
+func TestSavedPlanReachesOtherReplicas(t *testing.T) {
+	rl, m, _ := newTestLimiter(t)
+	other := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() { other.Close() })
+	replica := NewRateLimiter(other, 5, time.Minute)
+
+	pro := Plan{Name: "pro", Limit: 42, WindowSec: 60}
+	if err := rl.SavePlan(context.Background(), pro); err != nil {
+		t.Fatal(err)
+	}
+	if err := replica.LoadPlans(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := replica.PlanFor(&tenant.Tenant{Plan: "pro"}); got != pro {
+		t.Fatalf("replica has pro plan %+v, want %+v", got, pro)
+	}
+}
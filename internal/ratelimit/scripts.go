@@ -0,0 +1,162 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Algorithms selectable per plan
+const (
+	AlgorithmTokenBucket   = "token_bucket"
+	AlgorithmSlidingWindow = "sliding_window"
+)
+
+// Result is the outcome of a single limiter check
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration // until the next request would be admitted
+	ResetAfter time.Duration // until the quota is fully restored
+}
+
+// limitScript checks every counter in KEYS and consumes from all of them
+// only if each one has room, so a request blocked by one rule spends nothing
+// from the others. The clock comes from Redis (TIME) so that replicas with
+// skewed clocks still agree.
+//
+// ARGV holds four values per key: algorithm (tb or sw), limit, then for a
+// token bucket its refill rate in tokens/ms and for a sliding window its
+// window in ms, then a unique member for the sliding window log.
+//
+// A token bucket key (a hash of tokens and ts) refills continuously up to
+// limit tokens. A sliding window key (a sorted set of admitted request
+// timestamps) admits while fewer than limit fall within the window.
+//
+// Returns {admitted, then allowed, remaining, retry_ms, reset_ms per key},
+// where allowed says whether that counter had room.
+var limitScript = redis.NewScript(`
+redis.replicate_commands()
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local n = #KEYS
+local level = {}
+local admitted = 1
+for i = 1, n do
+  local algo = ARGV[i * 4 - 3]
+  local limit = tonumber(ARGV[i * 4 - 2])
+  local span = tonumber(ARGV[i * 4 - 1])
+  if algo == 'sw' then
+    redis.call('ZREMRANGEBYSCORE', KEYS[i], '-inf', now - span)
+    level[i] = redis.call('ZCARD', KEYS[i])
+    if level[i] >= limit then admitted = 0 end
+  else
+    local state = redis.call('HMGET', KEYS[i], 'tokens', 'ts')
+    local tokens = tonumber(state[1])
+    local ts = tonumber(state[2])
+    if tokens == nil or ts == nil then
+      tokens = limit
+      ts = now
+    end
+    level[i] = math.min(limit, tokens + math.max(0, now - ts) * span)
+    if level[i] < 1 then admitted = 0 end
+  end
+end
+
+local out = {admitted}
+for i = 1, n do
+  local algo = ARGV[i * 4 - 3]
+  local limit = tonumber(ARGV[i * 4 - 2])
+  local span = tonumber(ARGV[i * 4 - 1])
+  local allowed, remaining, retry, reset = 0, 0, 0, 0
+  if algo == 'sw' then
+    local count = level[i]
+    if count < limit then allowed = 1 end
+    if admitted == 1 then
+      redis.call('ZADD', KEYS[i], now, ARGV[i * 4])
+      count = count + 1
+    end
+    redis.call('PEXPIRE', KEYS[i], span)
+    local oldest = redis.call('ZRANGE', KEYS[i], 0, 0, 'WITHSCORES')
+    if oldest[2] then
+      reset = tonumber(oldest[2]) + span - now
+    end
+    if allowed == 0 then retry = reset end
+    remaining = limit - count
+  else
+    local tokens = level[i]
+    if tokens >= 1 then allowed = 1 end
+    if admitted == 1 then tokens = tokens - 1 end
+    if allowed == 0 then retry = math.ceil((1 - tokens) / span) end
+    reset = math.ceil((limit - tokens) / span)
+    redis.call('HSET', KEYS[i], 'tokens', tostring(tokens), 'ts', tostring(now))
+    redis.call('PEXPIRE', KEYS[i], math.max(reset, 1000))
+    remaining = math.floor(tokens)
+  end
+  table.insert(out, allowed)
+  table.insert(out, remaining)
+  table.insert(out, retry)
+  table.insert(out, reset)
+end
+return out
+`)
+
+// allow runs every check against Redis in a single atomic round trip. The
+// results are in the order of checks; admitted is false when any check has
+// no room, and then none of them was charged.
+func (rl *RateLimiter) allow(ctx context.Context, checks []check) (results []Result, admitted bool, err error) {
+	keys := make([]string, len(checks))
+	args := make([]any, 0, 4*len(checks))
+	for i, c := range checks {
+		windowMs := c.plan.Window().Milliseconds()
+		if c.plan.Limit <= 0 || windowMs <= 0 {
+			return nil, false, fmt.Errorf("invalid plan %q: limit %d window %dms", c.plan.Name, c.plan.Limit, windowMs)
+		}
+		switch c.plan.Algorithm {
+		case AlgorithmSlidingWindow:
+			keys[i] = c.key + ":sw"
+			args = append(args, "sw", c.plan.Limit, windowMs, requestMember())
+		default:
+			keys[i] = c.key + ":tb"
+			args = append(args, "tb", c.plan.Capacity(), float64(c.plan.Limit)/float64(windowMs), "")
+		}
+	}
+
+	vals, err := limitScript.Run(ctx, rl.redis, keys, args...).Int64Slice()
+	if err != nil {
+		return nil, false, err
+	}
+	if len(vals) != 1+4*len(checks) {
+		return nil, false, fmt.Errorf("unexpected script reply %v", vals)
+	}
+
+	results = make([]Result, len(checks))
+	for i, c := range checks {
+		n := vals[1+4*i:]
+		limit := c.plan.Limit
+		if c.plan.Algorithm != AlgorithmSlidingWindow {
+			limit = c.plan.Capacity()
+		}
+		results[i] = Result{
+			Allowed:    n[0] == 1,
+			Limit:      limit,
+			Remaining:  int(n[1]),
+			RetryAfter: time.Duration(n[2]) * time.Millisecond,
+			ResetAfter: time.Duration(n[3]) * time.Millisecond,
+		}
+	}
+	return results, vals[0] == 1, nil
+}
+
+// requestMember is a unique sorted-set member for the sliding window log
+func requestMember() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return fmt.Sprintf("%d-%s", time.Now().UnixNano(), hex.EncodeToString(buf))
+}
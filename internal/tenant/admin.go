@@ -0,0 +1,499 @@
+package tenant
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/decisionlog"
+)
+
+// TenantRequest is the body accepted when creating or updating a tenant
+type TenantRequest struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Status      string     `json:"status"`
+	ClientCerts []string   `json:"client_certs"`
+	Plan        string     `json:"plan"`
+	RateLimit   *RateLimit `json:"rate_limit"`
+	Quota       *Quota     `json:"quota"`
+	MaxInFlight *int       `json:"max_in_flight"`
+	Priority    *int       `json:"priority"`
+}
+
+// TenantResponse describes a tenant and its API keys
+type TenantResponse struct {
+	Tenant
+	APIKeys []KeyView `json:"api_keys"`
+}
+
+// KeyView is the admin-facing description of a stored key (no hash or salt)
+type KeyView struct {
+	ID          string     `json:"id"`
+	Prefix      string     `json:"prefix"`
+	Environment string     `json:"environment,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Active      bool       `json:"active"`
+}
+
+// KeyRequest is the body accepted when issuing a key
+type KeyRequest struct {
+	Environment  string `json:"environment"`    // "test" (default) or "live"
+	ExpiresInSec int    `json:"expires_in_sec"` // 0 = never expires
+}
+
+// RotateRequest is the body accepted when rotating a key
+type RotateRequest struct {
+	GraceSec *int `json:"grace_sec"` // how long the old key keeps working; absent = DefaultRotateGrace
+}
+
+// DefaultRotateGrace keeps a rotated key working while clients roll over,
+// unless the request asks for another grace (0 ends it at once)
+const DefaultRotateGrace = 24 * time.Hour
+
+// KeyResponse carries a freshly issued key; the secret is only ever shown once
+type KeyResponse struct {
+	TenantID string  `json:"tenant_id"`
+	APIKey   string  `json:"api_key"`
+	Key      KeyView `json:"key"`
+}
+
+// TenantsHandler handles GET /admin/tenants (list) and POST /admin/tenants (create)
+func TenantsHandler(w http.ResponseWriter, r *http.Request) {
+	store := GetStore()
+
+	switch r.Method {
+	case http.MethodGet:
+		tenants := store.List()
+		resp := make([]TenantResponse, 0, len(tenants))
+		for _, t := range tenants {
+			resp = append(resp, tenantResponse(store, t))
+		}
+		writeJSON(w, http.StatusOK, resp)
+
+	case http.MethodPost:
+		var req TenantRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.ID == "" {
+			http.Error(w, "id is required", http.StatusBadRequest)
+			return
+		}
+		if !validStatus(req.Status) {
+			http.Error(w, "status must be active or suspended", http.StatusBadRequest)
+			return
+		}
+		if err := validatePlan(req.Plan, req.RateLimit); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := validateQuota(req.Quota); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.MaxInFlight != nil && *req.MaxInFlight < 0 {
+			http.Error(w, "max_in_flight must not be negative", http.StatusBadRequest)
+			return
+		}
+
+		if req.Status == "" {
+			req.Status = StatusActive
+		}
+
+		t := Tenant{
+			ID:          req.ID,
+			Name:        req.Name,
+			Status:      req.Status,
+			ClientCerts: req.ClientCerts,
+			Plan:        req.Plan,
+			RateLimit:   req.RateLimit,
+			Quota:       req.Quota,
+		}
+		if req.MaxInFlight != nil {
+			t.MaxInFlight = *req.MaxInFlight
+		}
+		if req.Priority != nil {
+			t.Priority = *req.Priority
+		}
+		if err := store.Create(t); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+
+		decisionlog.LogDecision(r, decisionlog.DecisionTenant, "Tenant created", map[string]any{
+			"tenant":       t.ID,
+			"name":         t.Name,
+			"status":       t.Status,
+			"client_certs": t.ClientCerts,
+			"plan":         t.Plan,
+		})
+		writeJSON(w, http.StatusCreated, tenantResponse(store, t))
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// TenantHandler handles GET, PUT and DELETE on /admin/tenants/{id}
+func TenantHandler(w http.ResponseWriter, r *http.Request) {
+	store := GetStore()
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		t, ok := store.Get(id)
+		if !ok {
+			writeStoreError(w, ErrNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, tenantResponse(store, *t))
+
+	case http.MethodPut:
+		var req TenantRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if !validStatus(req.Status) {
+			http.Error(w, "status must be active or suspended", http.StatusBadRequest)
+			return
+		}
+		if req.MaxInFlight != nil && *req.MaxInFlight < 0 {
+			http.Error(w, "max_in_flight must not be negative", http.StatusBadRequest)
+			return
+		}
+
+		// Only fields present in the request are changed, on the stored
+		// tenant rather than a copy read earlier
+		t, err := store.Update(id, func(t *Tenant) error {
+			if req.Name != "" {
+				t.Name = req.Name
+			}
+			if req.Status != "" {
+				t.Status = req.Status
+			}
+			if req.ClientCerts != nil {
+				t.ClientCerts = req.ClientCerts
+			}
+			if req.Plan != "" {
+				t.Plan = req.Plan
+			}
+			if req.RateLimit != nil {
+				t.RateLimit = req.RateLimit
+			}
+			if req.Quota != nil {
+				t.Quota = req.Quota
+			}
+			if req.MaxInFlight != nil {
+				t.MaxInFlight = *req.MaxInFlight
+			}
+			if req.Priority != nil {
+				t.Priority = *req.Priority
+			}
+			if err := validatePlan(t.Plan, t.RateLimit); err != nil {
+				return invalidRequest{err}
+			}
+			if err := validateQuota(t.Quota); err != nil {
+				return invalidRequest{err}
+			}
+			return nil
+		})
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+
+		decisionlog.LogDecision(r, decisionlog.DecisionTenant, "Tenant updated", map[string]any{
+			"tenant":        t.ID,
+			"name":          t.Name,
+			"status":        t.Status,
+			"client_certs":  t.ClientCerts,
+			"plan":          t.Plan,
+			"rate_limit":    t.RateLimit,
+			"quota":         t.Quota,
+			"max_in_flight": t.MaxInFlight,
+			"priority":      t.Priority,
+		})
+		writeJSON(w, http.StatusOK, tenantResponse(store, *t))
+
+	case http.MethodDelete:
+		if err := store.Delete(id); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+
+		decisionlog.LogDecision(r, decisionlog.DecisionTenant, "Tenant deleted", map[string]any{
+			"tenant": id,
+		})
+		writeJSON(w, http.StatusOK, map[string]string{"message": "Tenant deleted"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// SuspendHandler handles POST /admin/tenants/{id}/suspend
+func SuspendHandler(w http.ResponseWriter, r *http.Request) {
+	setStatus(w, r, StatusSuspended, "Tenant suspended")
+}
+
+// ResumeHandler handles POST /admin/tenants/{id}/resume
+func ResumeHandler(w http.ResponseWriter, r *http.Request) {
+	setStatus(w, r, StatusActive, "Tenant resumed")
+}
+
+func setStatus(w http.ResponseWriter, r *http.Request, status, reason string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	store := GetStore()
+	t, err := store.Update(r.PathValue("id"), func(t *Tenant) error {
+		t.Status = status
+		return nil
+	})
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	decisionlog.LogDecision(r, decisionlog.DecisionTenant, reason, map[string]any{
+		"tenant": t.ID,
+		"status": status,
+	})
+	writeJSON(w, http.StatusOK, tenantResponse(store, *t))
+}
+
+// KeysHandler handles GET /admin/tenants/{id}/keys (list) and
+// POST /admin/tenants/{id}/keys (issue a new key)
+func KeysHandler(w http.ResponseWriter, r *http.Request) {
+	store := GetStore()
+	id := r.PathValue("id")
+	if _, ok := store.Get(id); !ok {
+		writeStoreError(w, ErrNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, keyViews(store.Keys(id)))
+
+	case http.MethodPost:
+		var req KeyRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+		}
+		if req.Environment == "" {
+			req.Environment = EnvTest
+		}
+
+		secret, err := GenerateKey(req.Environment)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		key := HashKey(secret)
+		if req.ExpiresInSec > 0 {
+			expiresAt := key.CreatedAt.Add(time.Duration(req.ExpiresInSec) * time.Second)
+			key.ExpiresAt = &expiresAt
+		}
+		if err := store.AddKey(id, key); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+
+		decisionlog.LogDecision(r, decisionlog.DecisionTenant, "API key issued", map[string]any{
+			"tenant":      id,
+			"key_id":      key.ID,
+			"environment": key.Environment,
+			"expires_at":  key.ExpiresAt,
+		})
+		writeJSON(w, http.StatusCreated, KeyResponse{TenantID: id, APIKey: secret, Key: keyView(key)})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// RevokeKeyHandler handles DELETE /admin/tenants/{id}/keys/{keyID}
+func RevokeKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, keyID := r.PathValue("id"), r.PathValue("keyID")
+	if err := GetStore().RevokeKey(id, keyID); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	decisionlog.LogDecision(r, decisionlog.DecisionTenant, "API key revoked", map[string]any{
+		"tenant": id,
+		"key_id": keyID,
+	})
+	writeJSON(w, http.StatusOK, map[string]string{"message": "API key revoked"})
+}
+
+// RotateKeyHandler handles POST /admin/tenants/{id}/keys/{keyID}/rotate.
+// A new key with the same environment is issued and the old one keeps
+// working for grace_sec seconds so clients can roll over without downtime.
+func RotateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	store := GetStore()
+	id, keyID := r.PathValue("id"), r.PathValue("keyID")
+
+	var req RotateRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	grace := DefaultRotateGrace
+	if req.GraceSec != nil {
+		if *req.GraceSec < 0 {
+			http.Error(w, "grace_sec must not be negative", http.StatusBadRequest)
+			return
+		}
+		grace = time.Duration(*req.GraceSec) * time.Second
+	}
+
+	var old *APIKey
+	for _, k := range store.Keys(id) {
+		if k.ID == keyID {
+			old = &k
+			break
+		}
+	}
+	if old == nil {
+		writeStoreError(w, ErrKeyNotFound)
+		return
+	}
+
+	env := old.Environment
+	if env == "" {
+		env = EnvTest
+	}
+	secret, err := GenerateKey(env)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	key := HashKey(secret)
+	graceUntil := key.CreatedAt.Add(grace)
+	if err := store.RotateKey(id, keyID, key, graceUntil); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	decisionlog.LogDecision(r, decisionlog.DecisionTenant, "API key rotated", map[string]any{
+		"tenant":      id,
+		"old_key_id":  keyID,
+		"new_key_id":  key.ID,
+		"grace_until": graceUntil,
+	})
+	writeJSON(w, http.StatusCreated, KeyResponse{TenantID: id, APIKey: secret, Key: keyView(key)})
+}
+
+func tenantResponse(store TenantStore, t Tenant) TenantResponse {
+	return TenantResponse{Tenant: t, APIKeys: keyViews(store.Keys(t.ID))}
+}
+
+func keyView(k APIKey) KeyView {
+	return KeyView{
+		ID:          k.ID,
+		Prefix:      k.Prefix,
+		Environment: k.Environment,
+		CreatedAt:   k.CreatedAt,
+		ExpiresAt:   k.ExpiresAt,
+		Active:      k.Active(time.Now()),
+	}
+}
+
+func keyViews(keys []APIKey) []KeyView {
+	views := make([]KeyView, 0, len(keys))
+	for _, k := range keys {
+		views = append(views, keyView(k))
+	}
+	return views
+}
+
+func validatePlan(plan string, limit *RateLimit) error {
+	if !ValidPlan(plan) {
+		return fmt.Errorf("unknown plan %q", plan)
+	}
+	if plan == PlanCustom && (limit == nil || limit.Limit <= 0 || limit.WindowSec <= 0) {
+		return errors.New("custom plan requires rate_limit with positive limit and window_sec")
+	}
+	if limit != nil {
+		switch limit.Algorithm {
+		case "", "token_bucket", "sliding_window":
+		default:
+			return fmt.Errorf("unknown rate limit algorithm %q", limit.Algorithm)
+		}
+	}
+	return nil
+}
+
+func validateQuota(q *Quota) error {
+	if q == nil {
+		return nil
+	}
+	if q.Daily < 0 || q.Monthly < 0 {
+		return errors.New("quota daily and monthly must not be negative")
+	}
+	for route, l := range q.Routes {
+		if !strings.HasPrefix(route, "/") {
+			return fmt.Errorf("quota route %q must start with /", route)
+		}
+		if l.Daily < 0 || l.Monthly < 0 {
+			return fmt.Errorf("quota for route %q must not be negative", route)
+		}
+	}
+	return nil
+}
+
+func validStatus(status string) bool {
+	return status == "" || status == StatusActive || status == StatusSuspended
+}
+
+// invalidRequest is a change the request asked for that would leave the
+// tenant invalid
+type invalidRequest struct {
+	error
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	var invalid invalidRequest
+	switch {
+	case errors.As(err, &invalid):
+		http.Error(w, invalid.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrKeyNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,100 @@
+package tenant
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// FileStore loads tenants from a YAML or JSON file and reloads it whenever
+// the file's modification time changes. Changes made through the admin API
+// are written back to the same file.
+type FileStore struct {
+	*MemoryStore
+	path string
+
+	modTime atomic.Int64 // UnixNano of the last file we loaded or wrote
+}
+
+// NewFileStore reads path once; call Watch to pick up later edits
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{MemoryStore: NewMemoryStore(), path: path}
+	s.persist = s.write
+	if err := s.Load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Load re-reads the file and swaps the snapshot
+func (s *FileStore) Load() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("tenant store: %w", err)
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("tenant store: %w", err)
+	}
+	doc, err := decodeDocument(s.path, data)
+	if err != nil {
+		return fmt.Errorf("tenant store: parse %s: %w", s.path, err)
+	}
+
+	s.Replace(doc.Tenants)
+	s.modTime.Store(info.ModTime().UnixNano())
+	return nil
+}
+
+// write replaces the file atomically via a temp file + rename
+func (s *FileStore) write(records map[string]Record, _ string, _ func(map[string]Record) error) error {
+	data, err := encodeDocument(s.path, Document{Tenants: sortedRecords(records)})
+	if err != nil {
+		return fmt.Errorf("tenant store: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".tenants-*")
+	if err != nil {
+		return fmt.Errorf("tenant store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("tenant store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("tenant store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("tenant store: %w", err)
+	}
+
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime.Store(info.ModTime().UnixNano())
+	}
+	return nil
+}
+
+// Watch polls the file every interval and reloads it when it changes.
+// A file that fails to parse keeps the previous snapshot in place.
+func (s *FileStore) Watch(interval time.Duration) {
+	go func() {
+		for {
+			time.Sleep(interval)
+
+			info, err := os.Stat(s.path)
+			if err != nil || info.ModTime().UnixNano() == s.modTime.Load() {
+				continue
+			}
+
+			if err := s.Load(); err != nil {
+				log.Printf("[TENANT STORE] reload failed: %v", err)
+				continue
+			}
+			log.Printf("[TENANT STORE] reloaded %s", s.path)
+		}
+	}()
+}
@@ -0,0 +1,273 @@
+package tenant
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// jwk is a single JSON Web Key as found in a JWKS document
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	// Symmetric (HS256)
+	K string `json:"k"`
+}
+
+// verificationKey is a parsed JWK ready for signature checks
+type verificationKey struct {
+	kid string
+	alg string // algorithm the key may be used with
+	key any    // *rsa.PublicKey, *ecdsa.PublicKey or []byte
+}
+
+// KeySet holds the keys used to verify bearer tokens. It is loaded from a
+// local JWKS file or fetched from a URL and refreshed periodically.
+type KeySet struct {
+	path string
+	url  string
+
+	client      *http.Client
+	refresh     time.Duration
+	minInterval time.Duration // lower bound between fetches on unknown kid
+
+	mu          sync.RWMutex
+	keys        []verificationKey
+	fetchedAt   time.Time
+	attemptedAt time.Time     // last fetch started, successful or not
+	inflight    chan struct{} // closed when the running fetch is done
+}
+
+// NewFileKeySet loads a JWKS document from disk
+func NewFileKeySet(path string) (*KeySet, error) {
+	ks := &KeySet{path: path}
+	if err := ks.Load(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// NewURLKeySet fetches a JWKS document and re-fetches it every refresh
+func NewURLKeySet(url string, refresh time.Duration) (*KeySet, error) {
+	ks := &KeySet{
+		url:         url,
+		client:      &http.Client{Timeout: 5 * time.Second},
+		refresh:     refresh,
+		minInterval: 30 * time.Second,
+		attemptedAt: time.Now(),
+	}
+	if err := ks.Load(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Load (re)reads the key set from its source
+func (ks *KeySet) Load() error {
+	var (
+		data []byte
+		err  error
+	)
+	if ks.url != "" {
+		data, err = ks.fetch()
+	} else {
+		data, err = os.ReadFile(ks.path)
+	}
+	if err != nil {
+		return fmt.Errorf("jwks: %w", err)
+	}
+
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("jwks: %w", err)
+	}
+
+	keys := make([]verificationKey, 0, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		vk, err := parseJWK(k)
+		if err == nil && k.Alg != "" && k.Alg != vk.alg {
+			err = fmt.Errorf("alg %q is not supported for %s keys", k.Alg, k.Kty)
+		}
+		if err != nil {
+			log.Printf("[JWKS] skipping key %q: %v", k.Kid, err)
+			continue
+		}
+		keys = append(keys, vk)
+	}
+	if len(keys) == 0 {
+		return errors.New("jwks: no usable keys")
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys = keys
+	ks.fetchedAt = time.Now()
+	return nil
+}
+
+func (ks *KeySet) fetch() ([]byte, error) {
+	resp, err := ks.client.Get(ks.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", ks.url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// startRefresh fetches the key set in the background, unless a fetch is
+// already running or the last one, failed or not, started under minInterval
+// ago. It returns a channel closed when the running fetch is done, or nil
+// when there is none.
+func (ks *KeySet) startRefresh() <-chan struct{} {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.inflight != nil {
+		return ks.inflight
+	}
+	if time.Since(ks.attemptedAt) < ks.minInterval {
+		return nil
+	}
+
+	done := make(chan struct{})
+	ks.inflight, ks.attemptedAt = done, time.Now()
+	go func() {
+		if err := ks.Load(); err != nil {
+			log.Printf("[JWKS] refresh failed: %v", err)
+		}
+		ks.mu.Lock()
+		ks.inflight = nil
+		ks.mu.Unlock()
+		close(done)
+	}()
+	return done
+}
+
+// candidates returns the keys that may have signed a token with kid and alg.
+// Remote key sets are refreshed in the background when stale; an unknown kid
+// waits for a refresh, since the issuer may have rotated keys. Concurrent
+// requests share one fetch.
+func (ks *KeySet) candidates(kid, alg string) []verificationKey {
+	if ks.url != "" {
+		ks.mu.RLock()
+		stale := time.Since(ks.fetchedAt) > ks.refresh
+		ks.mu.RUnlock()
+
+		switch {
+		case kid != "" && !ks.hasKid(kid):
+			if done := ks.startRefresh(); done != nil {
+				<-done
+			}
+		case stale:
+			ks.startRefresh()
+		}
+	}
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	var out []verificationKey
+	for _, k := range ks.keys {
+		if k.alg != alg {
+			continue
+		}
+		if kid != "" && k.kid != "" && k.kid != kid {
+			continue
+		}
+		out = append(out, k)
+	}
+	return out
+}
+
+func (ks *KeySet) hasKid(kid string) bool {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for _, k := range ks.keys {
+		if k.kid == kid {
+			return true
+		}
+	}
+	return false
+}
+
+func parseJWK(k jwk) (verificationKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		return verificationKey{
+			kid: k.Kid,
+			alg: "RS256",
+			key: &rsa.PublicKey{N: n, E: int(e.Int64())},
+		}, nil
+
+	case "EC":
+		if k.Crv != "P-256" {
+			return verificationKey{}, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !pub.Curve.IsOnCurve(x, y) {
+			return verificationKey{}, errors.New("point is not on curve")
+		}
+		return verificationKey{kid: k.Kid, alg: "ES256", key: pub}, nil
+
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		return verificationKey{kid: k.Kid, alg: "HS256", key: secret}, nil
+
+	default:
+		return verificationKey{}, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,196 @@
+package tenant
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWTConfig configures bearer token validation
+type JWTConfig struct {
+	Keys        *KeySet
+	Issuer      string        // expected iss; empty = not checked
+	Audience    string        // expected aud; empty = not checked
+	TenantClaim string        // claim holding the tenant ID (default "tenant_id")
+	Leeway      time.Duration // clock skew tolerated on exp/nbf
+	AllowNoExp  bool          // accept tokens without an exp claim
+}
+
+// JWTValidator verifies HS256/RS256/ES256 bearer tokens against a key set
+// and maps one of their claims to a tenant ID.
+type JWTValidator struct {
+	cfg JWTConfig
+}
+
+func NewJWTValidator(cfg JWTConfig) *JWTValidator {
+	if cfg.TenantClaim == "" {
+		cfg.TenantClaim = "tenant_id"
+	}
+	return &JWTValidator{cfg: cfg}
+}
+
+var (
+	jwtMu        sync.RWMutex
+	jwtValidator *JWTValidator
+)
+
+// SetJWTValidator enables bearer token authentication; nil disables it
+func SetJWTValidator(v *JWTValidator) {
+	jwtMu.Lock()
+	defer jwtMu.Unlock()
+	jwtValidator = v
+}
+
+func getJWTValidator() *JWTValidator {
+	jwtMu.RLock()
+	defer jwtMu.RUnlock()
+	return jwtValidator
+}
+
+// TenantID validates token and returns the tenant ID carried in its claims
+func (v *JWTValidator) TenantID(token string) (string, error) {
+	claims, err := v.Validate(token)
+	if err != nil {
+		return "", err
+	}
+	id, ok := claims[v.cfg.TenantClaim].(string)
+	if !ok || id == "" {
+		return "", fmt.Errorf("claim %q missing", v.cfg.TenantClaim)
+	}
+	return id, nil
+}
+
+// Validate checks the token signature and its exp, nbf, iss and aud claims
+func (v *JWTValidator) Validate(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("signature: %w", err)
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	keys := v.cfg.Keys.candidates(header.Kid, header.Alg)
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no key for alg %q kid %q", header.Alg, header.Kid)
+	}
+	verified := false
+	for _, k := range keys {
+		if verifySignature(k, signed, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.New("signature mismatch")
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("claims: %w", err)
+	}
+	if err := v.checkClaims(claims, time.Now()); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *JWTValidator) checkClaims(claims map[string]any, now time.Time) error {
+	exp, ok := numericClaim(claims, "exp")
+	if !ok && !v.cfg.AllowNoExp {
+		return errors.New("token has no expiry")
+	}
+	if ok && !now.Before(exp.Add(v.cfg.Leeway)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := numericClaim(claims, "nbf"); ok && now.Add(v.cfg.Leeway).Before(nbf) {
+		return errors.New("token not yet valid")
+	}
+	if v.cfg.Issuer != "" && claims["iss"] != v.cfg.Issuer {
+		return errors.New("unexpected issuer")
+	}
+	if v.cfg.Audience != "" && !hasAudience(claims["aud"], v.cfg.Audience) {
+		return errors.New("unexpected audience")
+	}
+	return nil
+}
+
+func verifySignature(k verificationKey, signed, sig []byte) bool {
+	digest := sha256.Sum256(signed)
+
+	switch key := k.key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write(signed)
+		return hmac.Equal(sig, mac.Sum(nil))
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	case *ecdsa.PublicKey:
+		if len(sig) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(key, digest[:], r, s)
+	default:
+		return false
+	}
+}
+
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func numericClaim(claims map[string]any, name string) (time.Time, bool) {
+	n, ok := claims[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	secs, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(secs), 0), true
+}
+
+// hasAudience handles aud as either a single string or an array
+func hasAudience(aud any, want string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == want
+	case []any:
+		for _, v := range a {
+			if v == want {
+				return true
+			}
+		}
+	}
+	return false
+}
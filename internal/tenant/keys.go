@@ -0,0 +1,127 @@
+package tenant
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Key environments, encoded in the key prefix (sk_test_..., sk_live_...)
+const (
+	EnvTest = "test"
+	EnvLive = "live"
+)
+
+// APIKey is the stored form of an API key. The secret itself is never kept:
+// only a salted SHA-256 hash plus a short prefix used to find candidates.
+type APIKey struct {
+	ID          string     `json:"id" yaml:"id"`
+	Prefix      string     `json:"prefix" yaml:"prefix"`
+	Environment string     `json:"environment,omitempty" yaml:"environment,omitempty"`
+	Salt        string     `json:"salt" yaml:"salt"`
+	Hash        string     `json:"hash" yaml:"hash"`
+	CreatedAt   time.Time  `json:"created_at" yaml:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" yaml:"expires_at,omitempty"`
+}
+
+// GenerateKey returns a new random API key for the given environment
+func GenerateKey(env string) (string, error) {
+	if env != EnvTest && env != EnvLive {
+		return "", fmt.Errorf("unknown key environment %q", env)
+	}
+	return "sk_" + env + "_" + randomHex(24), nil
+}
+
+// HashKey builds the stored form of secret with a fresh salt
+func HashKey(secret string) APIKey {
+	salt := randomHex(16)
+	return APIKey{
+		ID:          "key_" + randomHex(6),
+		Prefix:      keyPrefix(secret),
+		Environment: keyEnvironment(secret),
+		Salt:        salt,
+		Hash:        hashSecret(salt, secret),
+		CreatedAt:   time.Now().UTC(),
+	}
+}
+
+// Matches reports whether secret hashes to this key
+func (k APIKey) Matches(secret string) bool {
+	want, err := hex.DecodeString(k.Hash)
+	if err != nil {
+		return false
+	}
+	got, _ := hex.DecodeString(hashSecret(k.Salt, secret))
+	return subtle.ConstantTimeCompare(want, got) == 1
+}
+
+// Active reports whether the key has not yet expired
+func (k APIKey) Active(now time.Time) bool {
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+// UnmarshalJSON also accepts a bare string so that tenant files written with
+// plaintext keys keep loading; such keys are hashed on the way in.
+func (k *APIKey) UnmarshalJSON(data []byte) error {
+	var secret string
+	if err := json.Unmarshal(data, &secret); err == nil {
+		*k = legacyKey(secret)
+		return nil
+	}
+	type plain APIKey
+	return json.Unmarshal(data, (*plain)(k))
+}
+
+// UnmarshalYAML is the YAML counterpart of UnmarshalJSON
+func (k *APIKey) UnmarshalYAML(unmarshal func(any) error) error {
+	var secret string
+	if err := unmarshal(&secret); err == nil {
+		*k = legacyKey(secret)
+		return nil
+	}
+	type plain APIKey
+	return unmarshal((*plain)(k))
+}
+
+// legacyKey hashes a plaintext key from an old tenant file. Its ID is derived
+// from the secret so that it stays stable across reloads.
+func legacyKey(secret string) APIKey {
+	k := HashKey(secret)
+	k.ID = "key_" + hashSecret("", secret)[:12]
+	k.CreatedAt = time.Time{}
+	return k
+}
+
+// keyPrefix is the lookup index for a key. It never covers more than half of
+// the key so that short legacy keys are not stored in the clear.
+func keyPrefix(secret string) string {
+	return secret[:min(12, len(secret)/2)]
+}
+
+// keyEnvironment maps sk_test_/sk_live_ prefixes to an environment
+func keyEnvironment(secret string) string {
+	switch {
+	case strings.HasPrefix(secret, "sk_test_"):
+		return EnvTest
+	case strings.HasPrefix(secret, "sk_live_"):
+		return EnvLive
+	default:
+		return ""
+	}
+}
+
+func hashSecret(salt, secret string) string {
+	sum := sha256.Sum256([]byte(salt + secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
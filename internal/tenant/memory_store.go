@@ -0,0 +1,247 @@
+package tenant
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps tenants in process memory. It backs the file and Redis
+// stores as their local snapshot and is handy on its own for tests.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records map[string]Record   // tenant ID -> record
+	keys    map[string][]keyRef // key prefix -> candidate keys
+	certs   map[string]string   // client cert identity -> tenant ID
+
+	// persist, when set, writes a mutated snapshot to durable storage before
+	// it becomes visible. changedID is the tenant that was created, updated
+	// or deleted (absent from records in the latter case). fn is the
+	// mutation, which only touches changedID; a store shared with other
+	// writers re-applies it to its latest copy and puts the outcome in
+	// records.
+	persist func(records map[string]Record, changedID string, fn func(records map[string]Record) error) error
+}
+
+func NewMemoryStore(records ...Record) *MemoryStore {
+	s := &MemoryStore{}
+	s.Replace(records)
+	return s
+}
+
+// Replace atomically swaps the whole snapshot
+func (s *MemoryStore) Replace(records []Record) {
+	byID := make(map[string]Record, len(records))
+	for _, rec := range records {
+		byID[rec.ID] = rec
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = byID
+	s.keys = indexKeys(byID)
+	s.certs = indexCerts(byID)
+}
+
+// keyRef points from the prefix index back to the owning tenant
+type keyRef struct {
+	tenantID string
+	key      APIKey
+}
+
+func indexKeys(records map[string]Record) map[string][]keyRef {
+	keys := make(map[string][]keyRef)
+	for id, rec := range records {
+		for _, k := range rec.APIKeys {
+			keys[k.Prefix] = append(keys[k.Prefix], keyRef{tenantID: id, key: k})
+		}
+	}
+	return keys
+}
+
+func indexCerts(records map[string]Record) map[string]string {
+	certs := make(map[string]string)
+	for id, rec := range records {
+		for _, identity := range rec.ClientCerts {
+			certs[identity] = id
+		}
+	}
+	return certs
+}
+
+// findKey returns the stored key matching secret, expired or not
+func (s *MemoryStore) findKey(secret string) (keyRef, bool) {
+	for _, ref := range s.keys[keyPrefix(secret)] {
+		if ref.key.Matches(secret) {
+			return ref, true
+		}
+	}
+	return keyRef{}, false
+}
+
+func (s *MemoryStore) Lookup(apiKey string) (*Tenant, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ref, ok := s.findKey(apiKey)
+	if !ok || !ref.key.Active(time.Now()) {
+		return nil, false
+	}
+	t := s.records[ref.tenantID].Tenant
+	t.Environment = ref.key.Environment
+	t.KeyID = ref.key.ID
+	return &t, true
+}
+
+func (s *MemoryStore) LookupCert(identities []string) (*Tenant, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, identity := range identities {
+		if id, ok := s.certs[identity]; ok {
+			t := s.records[id].Tenant
+			return &t, true
+		}
+	}
+	return nil, false
+}
+
+func (s *MemoryStore) Get(id string) (*Tenant, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.records[id]
+	if !ok {
+		return nil, false
+	}
+	t := rec.Tenant
+	return &t, true
+}
+
+func (s *MemoryStore) List() []Tenant {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Tenant, 0, len(s.records))
+	for _, rec := range sortedRecords(s.records) {
+		out = append(out, rec.Tenant)
+	}
+	return out
+}
+
+func (s *MemoryStore) Keys(id string) []APIKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.records[id].APIKeys)
+}
+
+func (s *MemoryStore) Create(t Tenant) error {
+	return s.mutate(t.ID, func(records map[string]Record) error {
+		if _, ok := records[t.ID]; ok {
+			return ErrExists
+		}
+		records[t.ID] = Record{Tenant: t}
+		return nil
+	})
+}
+
+func (s *MemoryStore) Update(id string, change func(t *Tenant) error) (*Tenant, error) {
+	var updated Tenant
+	err := s.mutate(id, func(records map[string]Record) error {
+		rec, ok := records[id]
+		if !ok {
+			return ErrNotFound
+		}
+		if err := change(&rec.Tenant); err != nil {
+			return err
+		}
+		rec.ID = id
+		records[id] = rec
+		updated = rec.Tenant
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	return s.mutate(id, func(records map[string]Record) error {
+		if _, ok := records[id]; !ok {
+			return ErrNotFound
+		}
+		delete(records, id)
+		return nil
+	})
+}
+
+func (s *MemoryStore) AddKey(id string, key APIKey) error {
+	return s.mutate(id, func(records map[string]Record) error {
+		rec, ok := records[id]
+		if !ok {
+			return ErrNotFound
+		}
+		rec.APIKeys = append(slices.Clone(rec.APIKeys), key)
+		records[id] = rec
+		return nil
+	})
+}
+
+func (s *MemoryStore) RevokeKey(id, keyID string) error {
+	return s.mutate(id, func(records map[string]Record) error {
+		rec, ok := records[id]
+		if !ok {
+			return ErrNotFound
+		}
+		i := slices.IndexFunc(rec.APIKeys, func(k APIKey) bool { return k.ID == keyID })
+		if i < 0 {
+			return ErrKeyNotFound
+		}
+		rec.APIKeys = slices.Delete(slices.Clone(rec.APIKeys), i, i+1)
+		records[id] = rec
+		return nil
+	})
+}
+
+func (s *MemoryStore) RotateKey(id, oldKeyID string, newKey APIKey, graceUntil time.Time) error {
+	return s.mutate(id, func(records map[string]Record) error {
+		rec, ok := records[id]
+		if !ok {
+			return ErrNotFound
+		}
+		keys := slices.Clone(rec.APIKeys)
+		i := slices.IndexFunc(keys, func(k APIKey) bool { return k.ID == oldKeyID })
+		if i < 0 {
+			return ErrKeyNotFound
+		}
+		// Never extend a key that was already due to expire sooner
+		if keys[i].ExpiresAt == nil || graceUntil.Before(*keys[i].ExpiresAt) {
+			keys[i].ExpiresAt = &graceUntil
+		}
+		rec.APIKeys = append(keys, newKey)
+		records[id] = rec
+		return nil
+	})
+}
+
+// mutate applies fn to a copy of the snapshot, persists it and only then
+// makes it visible, so a failed write leaves the store untouched.
+func (s *MemoryStore) mutate(id string, fn func(records map[string]Record) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := make(map[string]Record, len(s.records))
+	for k, v := range s.records {
+		next[k] = v
+	}
+	if err := fn(next); err != nil {
+		return err
+	}
+	if s.persist != nil {
+		if err := s.persist(next, id, fn); err != nil {
+			return err
+		}
+	}
+
+	s.records = next
+	s.keys = indexKeys(next)
+	s.certs = indexCerts(next)
+	return nil
+}
@@ -0,0 +1,24 @@
+package tenant
+
+import "crypto/x509"
+
+// CertIdentities lists the names a client certificate can be matched on,
+// most specific first: SAN entries, then subject CN, then the full subject DN.
+func CertIdentities(cert *x509.Certificate) []string {
+	var ids []string
+	ids = append(ids, cert.DNSNames...)
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+	ids = append(ids, cert.EmailAddresses...)
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	ids = append(ids, cert.Subject.String())
+	return ids
+}
+
+// ResolveCertificate maps a verified client certificate to its tenant
+func ResolveCertificate(cert *x509.Certificate) (*Tenant, bool) {
+	return GetStore().LookupCert(CertIdentities(cert))
+}
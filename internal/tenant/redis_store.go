@@ -0,0 +1,149 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// redisTenantsKey is a hash of tenant ID -> JSON encoded Record
+	redisTenantsKey = "gateway:tenants"
+	// redisTenantsChannel is published to after every change so that all
+	// gateway replicas reload their snapshot
+	redisTenantsChannel = "gateway:tenants:changed"
+)
+
+// RedisStore keeps tenants in a Redis hash shared by every gateway replica.
+// Lookups are served from a local snapshot that is refreshed on pub/sub
+// notifications and on a fixed interval as a safety net.
+type RedisStore struct {
+	*MemoryStore
+	redis *redis.Client
+}
+
+// NewRedisStore loads the current snapshot from Redis; call Watch to keep it fresh
+func NewRedisStore(rdb *redis.Client) (*RedisStore, error) {
+	s := &RedisStore{MemoryStore: NewMemoryStore(), redis: rdb}
+	s.persist = s.write
+	if err := s.Load(context.Background()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Load reads every tenant from Redis and swaps the snapshot
+func (s *RedisStore) Load(ctx context.Context) error {
+	raw, err := s.redis.HGetAll(ctx, redisTenantsKey).Result()
+	if err != nil {
+		return fmt.Errorf("tenant store: %w", err)
+	}
+
+	records := make([]Record, 0, len(raw))
+	for id, data := range raw {
+		var rec Record
+		if err := json.Unmarshal([]byte(data), &rec); err != nil {
+			log.Printf("[TENANT STORE] skipping tenant %q: %v", id, err)
+			continue
+		}
+		rec.ID = id
+		records = append(records, rec)
+	}
+
+	s.Replace(records)
+	return nil
+}
+
+// maxWriteAttempts bounds the retries of a write that raced another replica
+const maxWriteAttempts = 10
+
+// write applies the change to the tenant as stored in Redis, not to this
+// replica's snapshot, which may be behind: the hash is watched while the
+// record is read, changed and written back, and the whole step is retried
+// if another replica wrote in between. The stored outcome is put in records
+// and the other replicas are notified.
+func (s *RedisStore) write(records map[string]Record, changedID string, fn func(map[string]Record) error) error {
+	ctx := context.Background()
+	update := func(tx *redis.Tx) error {
+		current := make(map[string]Record, 1)
+		data, err := tx.HGet(ctx, redisTenantsKey, changedID).Bytes()
+		switch {
+		case err == redis.Nil:
+		case err != nil:
+			return err
+		default:
+			var rec Record
+			if err := json.Unmarshal(data, &rec); err != nil {
+				return err
+			}
+			rec.ID = changedID
+			current[changedID] = rec
+		}
+		if err := fn(current); err != nil {
+			return err
+		}
+
+		rec, ok := current[changedID]
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if ok {
+				data, err := json.Marshal(rec)
+				if err != nil {
+					return err
+				}
+				pipe.HSet(ctx, redisTenantsKey, changedID, data)
+			} else {
+				pipe.HDel(ctx, redisTenantsKey, changedID)
+			}
+			pipe.Publish(ctx, redisTenantsChannel, changedID)
+			return nil
+		})
+		if err == nil {
+			if ok {
+				records[changedID] = rec
+			} else {
+				delete(records, changedID)
+			}
+		}
+		return err
+	}
+
+	for range maxWriteAttempts {
+		err := s.redis.Watch(ctx, update, redisTenantsKey)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("tenant store: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("tenant store: %s kept changing concurrently, try again", changedID)
+}
+
+// Watch reloads the snapshot whenever a change is published and every interval
+func (s *RedisStore) Watch(interval time.Duration) {
+	ctx := context.Background()
+
+	go func() {
+		sub := s.redis.Subscribe(ctx, redisTenantsChannel)
+		defer sub.Close()
+		for range sub.Channel() {
+			if err := s.Load(ctx); err != nil {
+				log.Printf("[TENANT STORE] reload failed: %v", err)
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			time.Sleep(interval)
+			if err := s.Load(ctx); err != nil {
+				log.Printf("[TENANT STORE] reload failed: %v", err)
+			}
+		}
+	}()
+}
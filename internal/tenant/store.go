@@ -0,0 +1,109 @@
+package tenant
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// TenantStore is the source of truth for tenants and their API keys.
+// Implementations must be safe for concurrent use since Lookup runs on
+// every request.
+type TenantStore interface {
+	// Lookup returns the tenant owning apiKey
+	Lookup(apiKey string) (*Tenant, bool)
+	// LookupCert returns the tenant claiming any of the certificate identities
+	LookupCert(identities []string) (*Tenant, bool)
+	// Get returns the tenant with the given ID
+	Get(id string) (*Tenant, bool)
+	// List returns every known tenant
+	List() []Tenant
+	// Keys returns the (hashed) API keys issued to a tenant
+	Keys(id string) []APIKey
+
+	Create(t Tenant) error
+	// Update applies change to the stored tenant and returns the result.
+	// change may run again on a fresher copy if another replica wrote in
+	// between, so it should only set the fields it means to change.
+	Update(id string, change func(t *Tenant) error) (*Tenant, error)
+	Delete(id string) error
+	AddKey(id string, key APIKey) error
+	RevokeKey(id, keyID string) error
+	// RotateKey adds newKey and keeps oldKeyID working until graceUntil
+	RotateKey(id, oldKeyID string, newKey APIKey, graceUntil time.Time) error
+}
+
+var (
+	ErrNotFound    = errors.New("tenant not found")
+	ErrExists      = errors.New("tenant already exists")
+	ErrKeyNotFound = errors.New("api key not found")
+)
+
+// Record is the persisted form of a tenant together with its API keys
+type Record struct {
+	Tenant  `yaml:",inline"`
+	APIKeys []APIKey `json:"api_keys" yaml:"api_keys"`
+}
+
+// Document is the on-disk layout shared by the file and Redis stores
+type Document struct {
+	Tenants []Record `json:"tenants" yaml:"tenants"`
+}
+
+var (
+	storeMu sync.RWMutex
+	store   TenantStore = NewMemoryStore(defaultRecords...)
+)
+
+// SetStore replaces the store used by Resolve and the middlewares
+func SetStore(s TenantStore) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	store = s
+}
+
+// GetStore returns the active tenant store
+func GetStore() TenantStore {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return store
+}
+
+// sortedRecords returns the records ordered by tenant ID
+func sortedRecords(records map[string]Record) []Record {
+	out := make([]Record, 0, len(records))
+	for _, rec := range records {
+		out = append(out, rec)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// encodeDocument is the inverse of decodeDocument
+func encodeDocument(path string, doc Document) ([]byte, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return json.MarshalIndent(doc, "", "  ")
+	default:
+		return yaml.Marshal(doc)
+	}
+}
+
+// decodeDocument parses data as JSON or YAML depending on the file extension
+func decodeDocument(path string, data []byte) (Document, error) {
+	var doc Document
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err := json.Unmarshal(data, &doc)
+		return doc, err
+	default:
+		err := yaml.Unmarshal(data, &doc)
+		return doc, err
+	}
+}
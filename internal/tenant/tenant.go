@@ -2,7 +2,10 @@ package tenant
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/decisionlog"
 )
@@ -12,16 +15,87 @@ type contextKey string
 
 const tenantKey contextKey = "tenant"
 
+// Tenant statuses
+const (
+	StatusActive    = "active"
+	StatusSuspended = "suspended"
+)
+
+// Plan tiers. Limits for each tier are defined by the rate limiter;
+// PlanCustom uses the tenant's own RateLimit.
+const (
+	PlanFree       = "free"
+	PlanPro        = "pro"
+	PlanEnterprise = "enterprise"
+	PlanCustom     = "custom"
+)
+
+// RateLimit is a tenant-specific limit used with PlanCustom
+type RateLimit struct {
+	Limit     int    `json:"limit" yaml:"limit"`
+	WindowSec int    `json:"window_sec" yaml:"window_sec"`
+	Algorithm string `json:"algorithm,omitempty" yaml:"algorithm,omitempty"`
+	Burst     int    `json:"burst,omitempty" yaml:"burst,omitempty"`
+}
+
+// QuotaLimits caps requests per UTC calendar day and month; 0 means no cap
+type QuotaLimits struct {
+	Daily   int64 `json:"daily,omitempty" yaml:"daily,omitempty"`
+	Monthly int64 `json:"monthly,omitempty" yaml:"monthly,omitempty"`
+}
+
+// Quota overrides the plan's billing quota for one tenant. Routes adds
+// separate caps for individual route prefixes on top of the overall one.
+type Quota struct {
+	QuotaLimits `yaml:",inline"`
+	Routes      map[string]QuotaLimits `json:"routes,omitempty" yaml:"routes,omitempty"`
+}
+
 // Tenant represents a simple tenant model
 type Tenant struct {
-	ID   string
-	Name string
+	ID     string `json:"id" yaml:"id"`
+	Name   string `json:"name" yaml:"name"`
+	Status string `json:"status,omitempty" yaml:"status,omitempty"` // empty = active
+
+	Plan      string     `json:"plan,omitempty" yaml:"plan,omitempty"` // empty = limiter default
+	RateLimit *RateLimit `json:"rate_limit,omitempty" yaml:"rate_limit,omitempty"`
+	Quota     *Quota     `json:"quota,omitempty" yaml:"quota,omitempty"` // nil = plan quota
+
+	// MaxInFlight caps concurrent requests; 0 = gateway default
+	MaxInFlight int `json:"max_in_flight,omitempty" yaml:"max_in_flight,omitempty"`
+	// Priority orders tenants for load shedding when a backend degrades:
+	// negative is shed first, positive last; 0 = normal
+	Priority int `json:"priority,omitempty" yaml:"priority,omitempty"`
+
+	// ClientCerts lists client certificate identities (DNS/URI/email SAN,
+	// subject CN or full subject DN) that authenticate as this tenant
+	ClientCerts []string `json:"client_certs,omitempty" yaml:"client_certs,omitempty"`
+
+	// Environment is taken from the prefix of the key used on the current
+	// request (test or live); it is never persisted.
+	Environment string `json:"-" yaml:"-"`
+	// KeyID identifies the API key used on the current request, if any
+	KeyID string `json:"-" yaml:"-"`
 }
 
-// Mock tenant DB (replace with real DB later)
-var tenants = map[string]Tenant{
-	"sk_test_123": {ID: "tenantA", Name: "Tenant A"},
-	"sk_test_456": {ID: "tenantB", Name: "Tenant B"},
+// ValidPlan reports whether plan is a known tier (empty means default)
+func ValidPlan(plan string) bool {
+	switch plan {
+	case "", PlanFree, PlanPro, PlanEnterprise, PlanCustom:
+		return true
+	}
+	return false
+}
+
+// Suspended reports whether the tenant has been suspended by an operator
+func (t *Tenant) Suspended() bool {
+	return t.Status == StatusSuspended
+}
+
+// defaultRecords seeds the in-memory store when no other store is configured
+var defaultRecords = []Record{
+	{Tenant: Tenant{ID: "tenantA", Name: "Tenant A"}, APIKeys: []APIKey{legacyKey("sk_test_123")}},
+	{Tenant: Tenant{ID: "tenantB", Name: "Tenant B"}, APIKeys: []APIKey{legacyKey("sk_test_456")}},
 }
 
 // FromContext returns tenant from request context
@@ -30,32 +104,96 @@ func FromContext(ctx context.Context) (*Tenant, bool) {
 	return t, ok
 }
 
+// Resolve looks up the tenant owning apiKey in the active store
 func Resolve(apiKey string) (*Tenant, bool) {
-	tenant, ok := tenants[apiKey]
-	return &tenant, ok
+	return GetStore().Lookup(apiKey)
+}
+
+// ResolveBearer validates a bearer token and returns the tenant it names
+func ResolveBearer(token string) (*Tenant, error) {
+	v := getJWTValidator()
+	if v == nil {
+		return nil, errors.New("bearer tokens are not enabled")
+	}
+	id, err := v.TenantID(token)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := GetStore().Get(id)
+	if !ok {
+		return nil, fmt.Errorf("unknown tenant %q", id)
+	}
+	return t, nil
+}
+
+// authenticate identifies the tenant behind a request. X-API-Key wins when
+// present, then an Authorization: Bearer token, then a verified TLS client
+// certificate. On failure the returned reason is suitable for both the
+// decision log and the client.
+func authenticate(r *http.Request) (t *Tenant, reason string, err error) {
+	if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+		t, ok := Resolve(apiKey)
+		if !ok {
+			return nil, "Invalid API Key", nil
+		}
+		return t, "API Key valid", nil
+	}
+
+	if token, ok := bearerToken(r); ok {
+		t, err := ResolveBearer(token)
+		if err != nil {
+			return nil, "Invalid bearer token", err
+		}
+		return t, "Bearer token valid", nil
+	}
+
+	// Only chains verified against the client CA bundle are trusted
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cert := r.TLS.VerifiedChains[0][0]
+		t, ok := ResolveCertificate(cert)
+		if !ok {
+			return nil, "Unknown client certificate", fmt.Errorf("no tenant for subject %q", cert.Subject.String())
+		}
+		return t, "Client certificate valid", nil
+	}
+
+	return nil, "Missing API Key", nil
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
 }
 
 func Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		apiKey := r.Header.Get("X-API-Key")
-		if apiKey == "" {
-			decisionlog.LogDecision(r, decisionlog.DecisionBlock, "Missing API Key", nil)
-			http.Error(w, "Missing API Key", http.StatusUnauthorized)
+		tenant, reason, err := authenticate(r)
+		if tenant == nil {
+			var extra map[string]any
+			if err != nil {
+				extra = map[string]any{"error": err.Error()}
+			}
+			decisionlog.LogDecision(r, decisionlog.DecisionBlock, reason, extra)
+			http.Error(w, reason, http.StatusUnauthorized)
 			return
 		}
 
-		tenant, ok := tenants[apiKey]
-		if !ok {
-			decisionlog.LogDecision(r, decisionlog.DecisionBlock, "Invalid API Key", nil)
-			http.Error(w, "Invalid API Key", http.StatusUnauthorized)
+		if tenant.Suspended() {
+			decisionlog.LogDecision(r, decisionlog.DecisionBlock, "Tenant suspended", map[string]any{
+				"tenant": tenant.ID,
+			})
+			http.Error(w, "Tenant suspended", http.StatusForbidden)
 			return
 		}
 
 		// attach tenant to context
-		ctx := context.WithValue(r.Context(), tenantKey, &tenant)
+		ctx := context.WithValue(r.Context(), tenantKey, tenant)
 		r = r.WithContext(ctx)
 
-		decisionlog.LogDecision(r, decisionlog.DecisionAllow, "API Key valid", map[string]any{
+		decisionlog.LogDecision(r, decisionlog.DecisionAllow, reason, map[string]any{
 			"tenant": tenant.ID,
 		})
 
@@ -63,14 +201,26 @@ func Middleware(next http.Handler) http.Handler {
 	})
 }
 
+// ResolutionMiddleware attaches the tenant to the context when the request
+// carries valid credentials but never rejects anonymous requests itself.
 func ResolutionMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		apiKey := r.Header.Get("X-API-Key")
-		if apiKey != "" {
-			if tenant, ok := Resolve(apiKey); ok {
-				ctx := context.WithValue(r.Context(), tenantKey, tenant)
-				r = r.WithContext(ctx)
+		// Already resolved further out in the chain
+		if _, ok := FromContext(r.Context()); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if tenant, _, _ := authenticate(r); tenant != nil {
+			if tenant.Suspended() {
+				decisionlog.LogDecision(r, decisionlog.DecisionBlock, "Tenant suspended", map[string]any{
+					"tenant": tenant.ID,
+				})
+				http.Error(w, "Tenant suspended", http.StatusForbidden)
+				return
 			}
+			ctx := context.WithValue(r.Context(), tenantKey, tenant)
+			r = r.WithContext(ctx)
 		}
 
 		next.ServeHTTP(w, r)
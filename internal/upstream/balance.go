@@ -0,0 +1,131 @@
+package upstream
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+)
+
+// balancer chooses an instance from candidates; it runs under Pool.mu. key
+// is only set for consistent hashing.
+type balancer interface {
+	pick(candidates []*Instance, key string) *Instance
+}
+
+func newBalancer(strategy string) balancer {
+	switch strategy {
+	case WeightedRoundRobin:
+		return &weightedRoundRobin{}
+	case LeastConn:
+		return &leastConn{}
+	case RandomTwo:
+		return randomTwo{}
+	case ConsistentHash:
+		return &consistentHash{}
+	default:
+		return &roundRobin{}
+	}
+}
+
+type roundRobin struct {
+	next int
+}
+
+func (b *roundRobin) pick(candidates []*Instance, _ string) *Instance {
+	if len(candidates) == 0 {
+		return nil
+	}
+	in := candidates[b.next%len(candidates)]
+	b.next++
+	return in
+}
+
+// weightedRoundRobin is nginx's smooth weighted round robin: weights 5,1,1
+// give a,a,b,a,c,a,a rather than a burst of five a's
+type weightedRoundRobin struct{}
+
+func (weightedRoundRobin) pick(candidates []*Instance, _ string) *Instance {
+	var best *Instance
+	total := 0
+	for _, in := range candidates {
+		in.current += in.Weight
+		total += in.Weight
+		if best == nil || in.current > best.current {
+			best = in
+		}
+	}
+	if best != nil {
+		best.current -= total
+	}
+	return best
+}
+
+// leastConn picks the fewest in-flight requests per unit of weight,
+// rotating the starting point so ties are shared
+type leastConn struct {
+	next int
+}
+
+func (b *leastConn) pick(candidates []*Instance, _ string) *Instance {
+	var best *Instance
+	var bestLoad float64
+	for i := range candidates {
+		in := candidates[(b.next+i)%len(candidates)]
+		load := float64(in.inFlight.Load()) / float64(in.Weight)
+		if best == nil || load < bestLoad {
+			best, bestLoad = in, load
+		}
+	}
+	b.next++
+	return best
+}
+
+// randomTwo samples two instances and keeps the less loaded one
+type randomTwo struct{}
+
+func (randomTwo) pick(candidates []*Instance, _ string) *Instance {
+	switch len(candidates) {
+	case 0:
+		return nil
+	case 1:
+		return candidates[0]
+	}
+	i := rand.IntN(len(candidates))
+	j := rand.IntN(len(candidates) - 1)
+	if j >= i {
+		j++
+	}
+	a, b := candidates[i], candidates[j]
+	if float64(b.inFlight.Load())/float64(b.Weight) < float64(a.inFlight.Load())/float64(a.Weight) {
+		return b
+	}
+	return a
+}
+
+// consistentHash uses weighted rendezvous hashing: a key keeps its instance
+// while that instance is a candidate, and only keys of a removed instance
+// move. Requests without a key fall back to round robin.
+type consistentHash struct {
+	fallback roundRobin
+}
+
+func (b *consistentHash) pick(candidates []*Instance, key string) *Instance {
+	if key == "" {
+		return b.fallback.pick(candidates, key)
+	}
+	var best *Instance
+	bestScore := math.Inf(-1)
+	for _, in := range candidates {
+		h := fnv.New64a()
+		h.Write([]byte(in.URL.String()))
+		h.Write([]byte{0})
+		h.Write([]byte(key))
+		// Map the hash into (0,1); -w/ln(u) favours heavier instances
+		u := (float64(h.Sum64()>>11) + 0.5) / (1 << 53)
+		score := -float64(in.Weight) / math.Log(u)
+		if score > bestScore {
+			best, bestScore = in, score
+		}
+	}
+	return best
+}
@@ -0,0 +1,185 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/decisionlog"
+)
+
+// HealthCheck probes every instance with GET Path. An instance leaves the
+// rotation after UnhealthyThreshold failed probes in a row and returns after
+// HealthyThreshold good ones; any 2xx or 3xx is good. Empty Path disables it.
+type HealthCheck struct {
+	Path               string
+	Interval           time.Duration // default 10s
+	Timeout            time.Duration // default 2s
+	HealthyThreshold   int           // default 2
+	UnhealthyThreshold int           // default 3
+}
+
+// Outlier ejects an instance for EjectionTime once ConsecutiveFailures
+// requests in a row failed to connect or answered 5xx. Zero
+// ConsecutiveFailures disables it.
+type Outlier struct {
+	ConsecutiveFailures int
+	EjectionTime        time.Duration // default 30s
+}
+
+func (h HealthCheck) validate() error {
+	if h.Path == "" {
+		if h != (HealthCheck{}) {
+			return fmt.Errorf("health_check needs a path")
+		}
+		return nil
+	}
+	if !strings.HasPrefix(h.Path, "/") {
+		return fmt.Errorf("health_check path %q must start with /", h.Path)
+	}
+	if h.Interval < 0 || h.Timeout < 0 || h.HealthyThreshold < 0 || h.UnhealthyThreshold < 0 {
+		return fmt.Errorf("health_check settings must not be negative")
+	}
+	if h.Interval > 0 && h.Timeout > h.Interval {
+		return fmt.Errorf("health_check timeout must not exceed the interval")
+	}
+	return nil
+}
+
+func (o Outlier) validate() error {
+	if o.ConsecutiveFailures < 0 || o.EjectionTime < 0 {
+		return fmt.Errorf("outlier settings must not be negative")
+	}
+	if o.ConsecutiveFailures == 0 && o.EjectionTime > 0 {
+		return fmt.Errorf("outlier needs consecutive_failures")
+	}
+	return nil
+}
+
+// available reports whether the instance may take requests at now
+func (in *Instance) available(now time.Time) bool {
+	return in.healthy.Load() && now.UnixNano() >= in.ejectedUntil.Load()
+}
+
+// candidates are the instances that may take requests. When every instance
+// is out the pool uses all of them: a guess beats failing every request.
+func (p *Pool) candidates() []*Instance {
+	now := time.Now()
+	out := make([]*Instance, 0, len(p.instances))
+	for _, in := range p.instances {
+		if in.available(now) {
+			out = append(out, in)
+		}
+	}
+	if len(out) == 0 {
+		return p.instances
+	}
+	return out
+}
+
+// observe feeds one proxied request's outcome to outlier detection
+func (p *Pool) observe(req *http.Request, in *Instance, failed bool, reason string) {
+	if !failed {
+		in.consecutiveFailures.Store(0)
+		return
+	}
+	o := p.spec.Outlier
+	if o.ConsecutiveFailures == 0 || in.consecutiveFailures.Add(1) < int64(o.ConsecutiveFailures) {
+		return
+	}
+	in.consecutiveFailures.Store(0)
+
+	until := time.Now().Add(o.EjectionTime)
+	in.ejectedUntil.Store(until.UnixNano())
+	in.ejections.Add(1)
+	decisionlog.LogDecision(req, decisionlog.DecisionHealth, "Upstream instance ejected", map[string]any{
+		"upstream":             p.name,
+		"instance":             in.URL.String(),
+		"consecutive_failures": o.ConsecutiveFailures,
+		"last_failure":         reason,
+		"ejected_until":        until,
+	})
+}
+
+// check runs the active health check loop until the pool is closed
+func (p *Pool) check() {
+	hc := p.spec.HealthCheck
+	client := &http.Client{
+		Timeout: hc.Timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	ticker := time.NewTicker(hc.Interval)
+	defer ticker.Stop()
+
+	for {
+		for _, in := range p.instances {
+			p.probe(client, in)
+		}
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Pool) probe(client *http.Client, in *Instance) {
+	hc := p.spec.HealthCheck
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, in.URL.JoinPath(hc.Path).String(), nil)
+	if err != nil {
+		return
+	}
+
+	reason := ""
+	resp, err := client.Do(req)
+	switch {
+	case err != nil:
+		reason = err.Error()
+	case resp.StatusCode >= 400:
+		reason = resp.Status
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+
+	if reason == "" {
+		in.probeFailures = 0
+		in.probeSuccesses++
+		if !in.healthy.Load() && in.probeSuccesses >= hc.HealthyThreshold {
+			in.healthy.Store(true)
+			decisionlog.LogDecision(req, decisionlog.DecisionHealth, "Upstream instance healthy again", map[string]any{
+				"upstream": p.name,
+				"instance": in.URL.String(),
+			})
+		}
+		return
+	}
+
+	in.probeSuccesses = 0
+	in.probeFailures++
+	if in.healthy.Load() && in.probeFailures >= hc.UnhealthyThreshold {
+		in.healthy.Store(false)
+		in.ejections.Add(1)
+		decisionlog.LogDecision(req, decisionlog.DecisionHealth, "Upstream instance failed health checks", map[string]any{
+			"upstream": p.name,
+			"instance": in.URL.String(),
+			"failures": in.probeFailures,
+			"error":    reason,
+		})
+	}
+}
+
+// Close stops the pool's health checks and drops its idle connections;
+// requests already routed finish
+func (p *Pool) Close() {
+	p.closeOnce.Do(func() {
+		close(p.done)
+		if tr, ok := p.transport.(*http.Transport); ok {
+			tr.CloseIdleConnections()
+		}
+	})
+}
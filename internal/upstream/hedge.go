@@ -0,0 +1,244 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/decisionlog"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/middleware"
+)
+
+var hedgesTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "api_gateway_hedges_total",
+		Help: "Total number of hedged upstream requests by upstream and result (sent, won)",
+	},
+	[]string{"upstream", "result"},
+)
+
+// Percentiles a hedge delay can follow; middleware.GetMetrics reports these
+var Percentiles = []string{"p50", "p95", "p99"}
+
+const (
+	// minHedgeDelay keeps very fast paths from hedging every request
+	minHedgeDelay = 5 * time.Millisecond
+
+	// percentileRefresh is how often the latency percentiles are re-read
+	percentileRefresh = time.Second
+)
+
+// Transport sends a route's requests upstream: a pool, or a layer such as
+// retries or hedging over one
+type Transport interface {
+	http.RoundTripper
+	Name() string
+}
+
+// HedgePolicy sends a second GET or HEAD to another instance when the first
+// has not answered within the delay. With Percentile set the delay is that
+// latency percentile of the request's path, and Delay only applies until
+// there is data; without it Delay is fixed.
+type HedgePolicy struct {
+	Delay      time.Duration
+	Percentile string // p50, p95 or p99
+}
+
+// Validate reports the first problem with the policy
+func (p HedgePolicy) Validate() error {
+	if p.Delay < 0 {
+		return fmt.Errorf("delay must not be negative")
+	}
+	if p.Percentile == "" {
+		if p.Delay == 0 {
+			return fmt.Errorf("set delay, percentile or both")
+		}
+		return nil
+	}
+	for _, known := range Percentiles {
+		if p.Percentile == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown percentile %q (known: %s)", p.Percentile, strings.Join(Percentiles, ", "))
+}
+
+// Hedger races a late first attempt against a second one on a different
+// instance, keeps whichever answers first and cancels the other. A 5xx only
+// wins once the other attempt has failed too.
+type Hedger struct {
+	pool   *Pool
+	policy HedgePolicy
+
+	// The percentiles are recomputed off the request path; requests read
+	// the latest snapshot without locking
+	refreshing atomic.Bool
+	refreshed  atomic.Int64                             // unix nanoseconds
+	delays     atomic.Pointer[map[string]time.Duration] // path -> percentile latency
+}
+
+func NewHedger(pool *Pool, policy HedgePolicy) *Hedger {
+	return &Hedger{pool: pool, policy: policy}
+}
+
+// Name is the pool's name
+func (h *Hedger) Name() string {
+	return h.pool.Name()
+}
+
+// delay is how long to wait for the first attempt to req's path; false
+// means do not hedge
+func (h *Hedger) delay(path string) (time.Duration, bool) {
+	if h.policy.Percentile == "" {
+		return max(h.policy.Delay, minHedgeDelay), true
+	}
+
+	if time.Since(time.Unix(0, h.refreshed.Load())) >= percentileRefresh && h.refreshing.CompareAndSwap(false, true) {
+		go func() {
+			defer h.refreshing.Store(false)
+			delays := percentileByPath(h.policy.Percentile)
+			h.delays.Store(&delays)
+			h.refreshed.Store(time.Now().UnixNano())
+		}()
+	}
+	if delays := h.delays.Load(); delays != nil {
+		if d, ok := (*delays)[path]; ok {
+			return max(d, minHedgeDelay), true
+		}
+	}
+	return max(h.policy.Delay, minHedgeDelay), h.policy.Delay > 0
+}
+
+// percentileByPath reads the latency percentile per request path from the
+// metrics collector, taking the slowest tenant so hedging stays the
+// exception for everyone
+func percentileByPath(percentile string) map[string]time.Duration {
+	percentiles, _ := middleware.GetMetrics()["latency_percentiles"].(map[string]map[string]float64)
+	out := make(map[string]time.Duration, len(percentiles))
+	for key, p := range percentiles {
+		// Keys are "<path>:<tenant>"
+		i := strings.LastIndex(key, ":")
+		if i < 0 {
+			continue
+		}
+		path := key[:i]
+		d := time.Duration(p[percentile] * float64(time.Millisecond))
+		out[path] = max(out[path], d)
+	}
+	return out
+}
+
+type attempt struct {
+	resp  *http.Response
+	err   error
+	hedge bool
+}
+
+func (h *Hedger) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return h.pool.RoundTrip(req)
+	}
+	path, _ := req.Context().Value(originalPathKey{}).(string)
+	if path == "" {
+		path = req.URL.Path
+	}
+	wait, ok := h.delay(path)
+	if !ok {
+		return h.pool.RoundTrip(req)
+	}
+
+	first, err := h.pool.Pick(req)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(chan attempt, 2)
+	var cancels [2]context.CancelFunc // first attempt, hedge
+	launch := func(in *Instance, hedge bool) {
+		ctx, cancel := context.WithCancel(req.Context())
+		cancels[btoi(hedge)] = cancel
+		go func() {
+			resp, err := h.pool.send(req.WithContext(ctx), in)
+			results <- attempt{resp: resp, err: err, hedge: hedge}
+		}()
+	}
+	launch(first, false)
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	pending := 1
+	var (
+		last     error
+		fallback *attempt // a 5xx, kept in case the other attempt does better
+	)
+	win := func(a attempt) *http.Response {
+		if a.hedge {
+			hedgesTotal.WithLabelValues(h.pool.Name(), "won").Inc()
+		}
+		// The winner's context lives until its body is closed
+		a.resp.Body = &releaseBody{ReadCloser: a.resp.Body, release: cancels[btoi(a.hedge)]}
+		return a.resp
+	}
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			second, err := h.pool.pick(req, first)
+			if err != nil {
+				continue // nowhere else to send it
+			}
+			hedgesTotal.WithLabelValues(h.pool.Name(), "sent").Inc()
+			decisionlog.LogDecision(req, decisionlog.DecisionRoute, "Hedging upstream request", map[string]any{
+				"upstream": h.pool.Name(),
+				"first":    first.URL.String(),
+				"second":   second.URL.String(),
+				"after_ms": wait.Milliseconds(),
+			})
+			launch(second, true)
+			pending++
+
+		case a := <-results:
+			pending--
+			mine, other := cancels[btoi(a.hedge)], cancels[btoi(!a.hedge)]
+			if a.err != nil {
+				mine()
+				last = a.err
+				continue // the other attempt may still answer
+			}
+			if a.resp.StatusCode >= 500 && pending > 0 {
+				fallback = &a
+				continue
+			}
+
+			if fallback != nil {
+				fallback.resp.Body.Close()
+				cancels[btoi(fallback.hedge)]()
+			}
+			if pending > 0 {
+				other()
+				go func() {
+					if lost := <-results; lost.resp != nil {
+						lost.resp.Body.Close()
+					}
+				}()
+			}
+			return win(a), nil
+		}
+	}
+	if fallback != nil {
+		return win(*fallback), nil
+	}
+	return nil, last
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,319 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/decisionlog"
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/tenant"
+)
+
+// Balancing strategies
+const (
+	RoundRobin         = "round_robin"
+	WeightedRoundRobin = "weighted_round_robin"
+	LeastConn          = "least_conn"
+	RandomTwo          = "random_two"
+	ConsistentHash     = "consistent_hash"
+)
+
+// Strategies lists the valid balance settings
+var Strategies = []string{RoundRobin, WeightedRoundRobin, LeastConn, RandomTwo, ConsistentHash}
+
+// ErrNoInstance is returned when a pool has no instance to send a request to
+var ErrNoInstance = errors.New("no upstream instance available")
+
+// Target is one instance of an upstream service
+type Target struct {
+	URL    string
+	Weight int // 0 = 1
+}
+
+// Spec describes a pool
+type Spec struct {
+	Targets []Target
+	Balance string // one of Strategies; empty = round_robin
+
+	// HashOn picks the consistent_hash key: "tenant" (default) or
+	// "header:<Name>". Requests without a key are spread round robin.
+	HashOn string
+
+	HealthCheck HealthCheck
+	Outlier     Outlier
+	Timeouts    Timeouts // unset ones take the registry's defaults
+}
+
+// Validate reports the first problem with the spec
+func (s Spec) Validate() error {
+	if len(s.Targets) == 0 {
+		return fmt.Errorf("no targets")
+	}
+	for _, t := range s.Targets {
+		u, err := url.Parse(t.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url %q must be an absolute http(s) URL", t.URL)
+		}
+		if t.Weight < 0 {
+			return fmt.Errorf("url %q: weight must not be negative", t.URL)
+		}
+	}
+	if s.Balance != "" && !slices.Contains(Strategies, s.Balance) {
+		return fmt.Errorf("unknown balance %q (known: %s)", s.Balance, strings.Join(Strategies, ", "))
+	}
+	if s.HashOn != "" {
+		if s.Balance != ConsistentHash {
+			return fmt.Errorf("hash_on needs balance %s", ConsistentHash)
+		}
+		if name, ok := strings.CutPrefix(s.HashOn, "header:"); s.HashOn != "tenant" && (!ok || name == "") {
+			return fmt.Errorf("hash_on %q must be \"tenant\" or \"header:<Name>\"", s.HashOn)
+		}
+	}
+	if err := s.HealthCheck.validate(); err != nil {
+		return err
+	}
+	if err := s.Timeouts.validate(); err != nil {
+		return err
+	}
+	return s.Outlier.validate()
+}
+
+func (s Spec) equal(o Spec) bool {
+	return s.Balance == o.Balance && s.HashOn == o.HashOn && slices.Equal(s.Targets, o.Targets) &&
+		s.HealthCheck == o.HealthCheck && s.Outlier == o.Outlier && s.Timeouts == o.Timeouts
+}
+
+// Instance is one backend in a pool with its live counters
+type Instance struct {
+	URL    *url.URL
+	Weight int
+
+	inFlight atomic.Int64
+	selected atomic.Uint64
+	failures atomic.Uint64
+
+	healthy             atomic.Bool  // active health checks
+	ejectedUntil        atomic.Int64 // outlier detection, unix nanos
+	consecutiveFailures atomic.Int64
+	ejections           atomic.Uint64
+
+	probeSuccesses, probeFailures int // owned by the health check loop
+
+	current int // smooth weighted round robin state, guarded by Pool.mu
+}
+
+// InstanceStats is an instance's entry in /admin/upstreams
+type InstanceStats struct {
+	URL      string `json:"url"`
+	Weight   int    `json:"weight"`
+	InFlight int64  `json:"in_flight"`
+	Selected uint64 `json:"selected"`
+	Failures uint64 `json:"failures"`
+
+	Healthy      bool       `json:"healthy"`
+	EjectedUntil *time.Time `json:"ejected_until,omitempty"`
+	Ejections    uint64     `json:"ejections"`
+}
+
+// Stats is a pool's entry in /admin/upstreams
+type Stats struct {
+	Name      string          `json:"name"`
+	Balance   string          `json:"balance"`
+	HashOn    string          `json:"hash_on,omitempty"`
+	Instances []InstanceStats `json:"instances"`
+}
+
+// Pool spreads requests over the instances of one upstream. It is an
+// http.RoundTripper: the reverse proxy hands it requests addressed to the
+// pool and it sends each to the instance the strategy picks.
+type Pool struct {
+	name      string
+	spec      Spec
+	instances []*Instance
+	balancer  balancer
+	transport http.RoundTripper
+
+	mu sync.Mutex // guards balancer state
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewPool builds a pool and starts its health checks, if any; Close stops
+// them
+func NewPool(name string, spec Spec) (*Pool, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	spec = normalize(spec)
+
+	p := &Pool{
+		name:      name,
+		spec:      spec,
+		balancer:  newBalancer(spec.Balance),
+		transport: newTransport(spec.Timeouts),
+		done:      make(chan struct{}),
+	}
+	for _, t := range spec.Targets {
+		u, _ := url.Parse(t.URL)
+		in := &Instance{URL: u, Weight: max(t.Weight, 1)}
+		in.healthy.Store(true)
+		p.instances = append(p.instances, in)
+	}
+	if spec.HealthCheck.Path != "" {
+		go p.check()
+	}
+	return p, nil
+}
+
+// Name is the upstream name the pool was configured under
+func (p *Pool) Name() string {
+	return p.name
+}
+
+// Stats snapshots the pool's counters
+func (p *Pool) Stats() Stats {
+	s := Stats{Name: p.name, Balance: p.spec.Balance, HashOn: p.spec.HashOn}
+	now := time.Now()
+	for _, in := range p.instances {
+		st := InstanceStats{
+			URL:       in.URL.String(),
+			Weight:    in.Weight,
+			InFlight:  in.inFlight.Load(),
+			Selected:  in.selected.Load(),
+			Failures:  in.failures.Load(),
+			Healthy:   in.available(now),
+			Ejections: in.ejections.Load(),
+		}
+		if until := time.Unix(0, in.ejectedUntil.Load()); until.After(now) {
+			st.EjectedUntil = &until
+		}
+		s.Instances = append(s.Instances, st)
+	}
+	return s
+}
+
+// hashKey is the consistent hashing key for req, empty when it has none
+func (p *Pool) hashKey(req *http.Request) string {
+	if name, ok := strings.CutPrefix(p.spec.HashOn, "header:"); ok {
+		return req.Header.Get(name)
+	}
+	if t, ok := tenant.FromContext(req.Context()); ok {
+		return t.ID
+	}
+	return ""
+}
+
+// Pick selects the instance for req among those not ejected
+func (p *Pool) Pick(req *http.Request) (*Instance, error) {
+	return p.pick(req, nil)
+}
+
+// pick selects an instance other than avoid
+func (p *Pool) pick(req *http.Request, avoid *Instance) (*Instance, error) {
+	if len(p.instances) == 0 {
+		return nil, ErrNoInstance
+	}
+	var key string
+	if p.spec.Balance == ConsistentHash {
+		key = p.hashKey(req)
+	}
+	candidates := p.candidates()
+	if avoid != nil {
+		candidates = slices.DeleteFunc(slices.Clone(candidates), func(in *Instance) bool { return in == avoid })
+	}
+
+	p.mu.Lock()
+	in := p.balancer.pick(candidates, key)
+	p.mu.Unlock()
+	if in == nil {
+		return nil, ErrNoInstance
+	}
+	in.selected.Add(1)
+	return in, nil
+}
+
+type originalPathKey struct{}
+
+// WithOriginalPath records the client's path before any rewrite, for the
+// forwarding decision log
+func WithOriginalPath(ctx context.Context, path string) context.Context {
+	return context.WithValue(ctx, originalPathKey{}, path)
+}
+
+// RoundTrip sends req to the picked instance. The instance counts as in
+// flight until the response body is closed.
+func (p *Pool) RoundTrip(req *http.Request) (*http.Response, error) {
+	in, err := p.Pick(req)
+	if err != nil {
+		return nil, err
+	}
+	return p.send(req, in)
+}
+
+func (p *Pool) send(req *http.Request, in *Instance) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.URL.Scheme = in.URL.Scheme
+	out.URL.Host = in.URL.Host
+	out.URL.Path = joinPath(in.URL.Path, req.URL.Path)
+	out.URL.RawPath = ""
+	setDeadline(out)
+
+	extra := map[string]any{
+		"upstream":      p.name,
+		"instance":      in.URL.String(),
+		"upstream_url":  out.URL.String(),
+		"upstream_host": out.Host,
+	}
+	if original, ok := req.Context().Value(originalPathKey{}).(string); ok {
+		extra["original_path"] = original
+	}
+	decisionlog.LogDecision(out, decisionlog.DecisionRoute, "Forwarding to upstream", extra)
+
+	in.inFlight.Add(1)
+	resp, err := p.transport.RoundTrip(out)
+	if err != nil {
+		in.inFlight.Add(-1)
+		in.failures.Add(1)
+		// A client that went away says nothing about the instance
+		p.observe(out, in, !errors.Is(req.Context().Err(), context.Canceled), err.Error())
+		return nil, err
+	}
+	if resp.StatusCode >= 500 {
+		in.failures.Add(1)
+	}
+	p.observe(out, in, resp.StatusCode >= 500, resp.Status)
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: func() { in.inFlight.Add(-1) }}
+	return resp, nil
+}
+
+// releaseBody runs release once, when the body is closed
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+func joinPath(base, p string) string {
+	switch {
+	case base == "" || base == "/":
+		return p
+	case p == "" || p == "/":
+		return base
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(p, "/")
+}
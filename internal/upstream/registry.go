@@ -0,0 +1,135 @@
+package upstream
+
+import (
+	"cmp"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Registry holds the pools of the routing table being served. Pools whose
+// spec is unchanged survive a reload, counters and all.
+type Registry struct {
+	defaults Timeouts
+
+	mu    sync.RWMutex
+	pools map[string]*Pool
+}
+
+// NewRegistry returns an empty registry whose pools take defaults for the
+// timeouts their upstream leaves unset
+func NewRegistry(defaults Timeouts) *Registry {
+	return &Registry{defaults: defaults, pools: make(map[string]*Pool)}
+}
+
+// Update is a prepared set of pools, not yet served. Commit installs it;
+// Abort discards it. Exactly one of them must be called.
+type Update struct {
+	registry *Registry
+	pools    map[string]*Pool
+	created  []*Pool
+}
+
+// Prepare builds the pools for specs, reusing those that did not change.
+// The registered set is left alone until the update is committed, so a
+// reload that fails later still has its old pools. Prepares must not
+// overlap.
+func (r *Registry) Prepare(specs map[string]Spec) (*Update, error) {
+	r.mu.RLock()
+	current := r.pools
+	r.mu.RUnlock()
+
+	u := &Update{registry: r, pools: make(map[string]*Pool, len(specs))}
+	for name, spec := range specs {
+		spec.Timeouts = spec.Timeouts.or(r.defaults)
+		if old, ok := current[name]; ok && old.spec.equal(normalize(spec)) {
+			u.pools[name] = old
+			continue
+		}
+		p, err := NewPool(name, spec)
+		if err != nil {
+			u.Abort()
+			return nil, err
+		}
+		u.pools[name] = p
+		u.created = append(u.created, p)
+	}
+	return u, nil
+}
+
+// Pools are the update's pools by name
+func (u *Update) Pools() map[string]*Pool {
+	return u.pools
+}
+
+// Commit makes the update the registered set and closes the pools it
+// replaced
+func (u *Update) Commit() {
+	r := u.registry
+	r.mu.Lock()
+	old := r.pools
+	r.pools = u.pools
+	r.mu.Unlock()
+
+	for name, p := range old {
+		if u.pools[name] != p {
+			p.Close()
+		}
+	}
+}
+
+// Abort closes the pools the update created, leaving the registered set as
+// it was
+func (u *Update) Abort() {
+	for _, p := range u.created {
+		p.Close()
+	}
+}
+
+// normalize fills in the defaults NewPool applies, so specs compare equal
+// whether or not they spell them out
+func normalize(s Spec) Spec {
+	if s.Balance == "" {
+		s.Balance = RoundRobin
+	}
+	if s.Balance == ConsistentHash && s.HashOn == "" {
+		s.HashOn = "tenant"
+	}
+	if s.HealthCheck.Path != "" {
+		s.HealthCheck.Interval = cmp.Or(s.HealthCheck.Interval, 10*time.Second)
+		s.HealthCheck.Timeout = cmp.Or(s.HealthCheck.Timeout, 2*time.Second)
+		s.HealthCheck.HealthyThreshold = cmp.Or(s.HealthCheck.HealthyThreshold, 2)
+		s.HealthCheck.UnhealthyThreshold = cmp.Or(s.HealthCheck.UnhealthyThreshold, 3)
+	}
+	if s.Outlier.ConsecutiveFailures > 0 {
+		s.Outlier.EjectionTime = cmp.Or(s.Outlier.EjectionTime, 30*time.Second)
+	}
+	return s
+}
+
+// Stats snapshots every pool, sorted by name
+func (r *Registry) Stats() []Stats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := make([]Stats, 0, len(r.pools))
+	for _, name := range slices.Sorted(maps.Keys(r.pools)) {
+		out = append(out, r.pools[name].Stats())
+	}
+	return out
+}
+
+// Handler handles GET /admin/upstreams
+func Handler(r *Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.Stats())
+	}
+}
@@ -0,0 +1,284 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CSroseX/Multi-tenant-Distributed-API-Gateway/internal/decisionlog"
+)
+
+// Retry conditions besides status codes
+const (
+	RetryConnectError = "connect_error" // never connected: dial refused or timed out, TLS handshake failed
+	Retry5xx          = "5xx"
+)
+
+// maxReplayBody is the largest request body buffered for replay; bigger
+// bodies are streamed and get a single attempt
+const maxReplayBody = 1 << 20
+
+// budgetWindow is the period the retry budget is measured over
+const budgetWindow = 10 * time.Second
+
+// RetryPolicy is a route's retry settings
+type RetryPolicy struct {
+	Attempts   int           // total attempts including the first
+	On         []string      // connect_error, 5xx or status codes like "503"
+	Backoff    time.Duration // base of the exponential backoff, default 25ms
+	MaxBackoff time.Duration // default 250ms
+
+	// BudgetPercent caps retries at this share of the route's requests over
+	// the last 10s (default 20), with a floor of MinRetries (default 3), so
+	// a failing upstream does not get hit with a retry storm.
+	BudgetPercent float64
+	MinRetries    int
+}
+
+// DefaultRetryOn retries what is almost always transient
+var DefaultRetryOn = []string{RetryConnectError, "502", "503", "504"}
+
+// Validate reports the first problem with the policy
+func (p RetryPolicy) Validate() error {
+	if p.Attempts < 1 {
+		return fmt.Errorf("attempts must be at least 1")
+	}
+	for _, c := range p.On {
+		if c == RetryConnectError || c == Retry5xx {
+			continue
+		}
+		if code, err := strconv.Atoi(c); err != nil || code < 400 || code > 599 {
+			return fmt.Errorf("unknown retry condition %q (want %s, %s or a 4xx/5xx status)", c, RetryConnectError, Retry5xx)
+		}
+	}
+	if p.Backoff < 0 || p.MaxBackoff < 0 || p.BudgetPercent < 0 || p.MinRetries < 0 {
+		return fmt.Errorf("retry settings must not be negative")
+	}
+	return nil
+}
+
+// Retrier retries requests through the next layer (a pool, or a hedger over
+// one); every attempt is balanced anew, so a retry usually lands on another
+// instance
+type Retrier struct {
+	next   Transport
+	policy RetryPolicy
+	budget budget
+}
+
+func NewRetrier(next Transport, policy RetryPolicy) *Retrier {
+	if len(policy.On) == 0 {
+		policy.On = DefaultRetryOn
+	}
+	if policy.Backoff == 0 {
+		policy.Backoff = 25 * time.Millisecond
+	}
+	if policy.MaxBackoff == 0 {
+		policy.MaxBackoff = 250 * time.Millisecond
+	}
+	if policy.BudgetPercent == 0 {
+		policy.BudgetPercent = 20
+	}
+	if policy.MinRetries == 0 {
+		policy.MinRetries = 3
+	}
+	return &Retrier{
+		next:   next,
+		policy: policy,
+		budget: budget{percent: policy.BudgetPercent, min: policy.MinRetries, start: time.Now()},
+	}
+}
+
+// Name is the upstream's name
+func (rt *Retrier) Name() string {
+	return rt.next.Name()
+}
+
+// idempotent methods can be replayed safely; others only with an
+// Idempotency-Key the upstream deduplicates on
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+func (rt *Retrier) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.budget.request()
+	if rt.policy.Attempts < 2 || !idempotent(req) {
+		return rt.next.RoundTrip(req)
+	}
+
+	body, replayable, err := bufferBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if !replayable {
+		return rt.next.RoundTrip(req)
+	}
+
+	for attempt := 1; ; attempt++ {
+		out := req
+		if body != nil {
+			out = req.Clone(req.Context())
+			out.Body = io.NopCloser(bytes.NewReader(body))
+			out.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(body)), nil
+			}
+		}
+
+		resp, err := rt.next.RoundTrip(out)
+		reason := rt.retryable(req.Context(), resp, err)
+		if reason == "" || attempt >= rt.policy.Attempts || !rt.budget.retry() {
+			if reason != "" && attempt < rt.policy.Attempts {
+				decisionlog.LogDecision(req, decisionlog.DecisionBlock, "Retry budget exhausted", map[string]any{
+					"upstream": rt.next.Name(),
+					"attempt":  attempt,
+					"reason":   reason,
+				})
+			}
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		wait := rt.backoff(attempt)
+		decisionlog.LogDecision(req, decisionlog.DecisionRoute, "Retrying upstream request", map[string]any{
+			"upstream":   rt.next.Name(),
+			"attempt":    attempt + 1,
+			"reason":     reason,
+			"backoff_ms": wait.Milliseconds(),
+		})
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable names the condition an attempt's outcome matched, or "" when it
+// should be returned as is
+func (rt *Retrier) retryable(ctx context.Context, resp *http.Response, err error) string {
+	if err != nil {
+		if ctx.Err() != nil || !connectFailed(err) || !slices.Contains(rt.policy.On, RetryConnectError) {
+			return ""
+		}
+		return RetryConnectError
+	}
+	code := strconv.Itoa(resp.StatusCode)
+	switch {
+	case slices.Contains(rt.policy.On, code):
+		return code
+	case resp.StatusCode >= 500 && slices.Contains(rt.policy.On, Retry5xx):
+		return Retry5xx
+	}
+	return ""
+}
+
+// connectFailed reports whether err happened before the request could be
+// sent: dialing or the TLS handshake failed. Timeouts waiting for response
+// headers and resets after sending are not, as the upstream may have acted
+// on the request.
+func connectFailed(err error) bool {
+	var (
+		opErr     *net.OpError
+		recordErr tls.RecordHeaderError
+		alertErr  tls.AlertError
+		verifyErr *tls.CertificateVerificationError
+	)
+	switch {
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return true
+	case errors.As(err, &recordErr), errors.As(err, &alertErr), errors.As(err, &verifyErr):
+		return true
+	}
+	// net/http does not export its handshake timeout error
+	return strings.Contains(err.Error(), "TLS handshake timeout")
+}
+
+// backoff is exponential with full jitter. The ceiling stops doubling at
+// MaxBackoff, so a large attempt count cannot overflow it.
+func (rt *Retrier) backoff(attempt int) time.Duration {
+	ceiling := rt.policy.Backoff
+	for i := 1; i < attempt && ceiling < rt.policy.MaxBackoff; i++ {
+		ceiling *= 2
+	}
+	ceiling = min(ceiling, rt.policy.MaxBackoff)
+	return time.Duration(rand.Int64N(int64(ceiling) + 1))
+}
+
+// bufferBody reads the request body so it can be sent again. A body over
+// maxReplayBody is put back together unread and reported not replayable.
+func bufferBody(req *http.Request) ([]byte, bool, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true, nil
+	}
+	buf, err := io.ReadAll(io.LimitReader(req.Body, maxReplayBody+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(buf) > maxReplayBody {
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), req.Body), req.Body}
+		return nil, false, nil
+	}
+	req.Body.Close()
+	return buf, true, nil
+}
+
+// budget counts requests and retries over budgetWindow
+type budget struct {
+	percent float64
+	min     int
+
+	mu       sync.Mutex
+	start    time.Time
+	requests int
+	retries  int
+}
+
+func (b *budget) roll() {
+	if time.Since(b.start) >= budgetWindow {
+		b.start = time.Now()
+		b.requests, b.retries = 0, 0
+	}
+}
+
+func (b *budget) request() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll()
+	b.requests++
+}
+
+// retry takes one retry from the budget if there is one left
+func (b *budget) retry() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll()
+	if float64(b.retries) >= max(float64(b.min), b.percent/100*float64(b.requests)) {
+		return false
+	}
+	b.retries++
+	return true
+}
@@ -0,0 +1,75 @@
+package upstream
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Timeouts bound the phases of an upstream connection. The whole request
+// is bounded by the route's timeout, whose remaining budget is forwarded in
+// X-Request-Deadline and grpc-timeout.
+type Timeouts struct {
+	Dial           time.Duration
+	TLSHandshake   time.Duration
+	ResponseHeader time.Duration // from request written to response headers read
+}
+
+// DefaultTimeouts apply where neither the upstream nor the registry sets one
+var DefaultTimeouts = Timeouts{
+	Dial:           5 * time.Second,
+	TLSHandshake:   5 * time.Second,
+	ResponseHeader: 30 * time.Second,
+}
+
+func (t Timeouts) validate() error {
+	if t.Dial < 0 || t.TLSHandshake < 0 || t.ResponseHeader < 0 {
+		return fmt.Errorf("timeouts must not be negative")
+	}
+	return nil
+}
+
+// or fills t's unset timeouts from d
+func (t Timeouts) or(d Timeouts) Timeouts {
+	if t.Dial == 0 {
+		t.Dial = d.Dial
+	}
+	if t.TLSHandshake == 0 {
+		t.TLSHandshake = d.TLSHandshake
+	}
+	if t.ResponseHeader == 0 {
+		t.ResponseHeader = d.ResponseHeader
+	}
+	return t
+}
+
+func newTransport(t Timeouts) *http.Transport {
+	t = t.or(DefaultTimeouts)
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.DialContext = (&net.Dialer{Timeout: t.Dial, KeepAlive: 30 * time.Second}).DialContext
+	tr.TLSHandshakeTimeout = t.TLSHandshake
+	tr.ResponseHeaderTimeout = t.ResponseHeader
+	return tr
+}
+
+// setDeadline tells the upstream how long the gateway will wait for it
+func setDeadline(req *http.Request) {
+	deadline, ok := req.Context().Deadline()
+	if !ok {
+		return
+	}
+	req.Header.Set("X-Request-Deadline", deadline.UTC().Format(time.RFC3339Nano))
+	req.Header.Set("grpc-timeout", grpcTimeout(time.Until(deadline)))
+}
+
+// grpcTimeout formats d as a gRPC timeout: at most 8 digits and a unit
+func grpcTimeout(d time.Duration) string {
+	ms := max(1, int64(math.Ceil(float64(d)/float64(time.Millisecond))))
+	if ms < 1e8 {
+		return strconv.FormatInt(ms, 10) + "m"
+	}
+	return strconv.FormatInt(min(99999999, ms/1000), 10) + "S"
+}